@@ -2,6 +2,7 @@ package config
 
 import (
 	"sync"
+	"time"
 )
 
 var confWatch = configHolder{}
@@ -9,6 +10,12 @@ var confWatch = configHolder{}
 type configHolder struct {
 	lock      sync.RWMutex
 	confItems []confItem
+	listeners []*listener
+}
+
+// listener wraps a change function so it can be found when it's removed
+type listener struct {
+	fn func()
 }
 
 type confItem struct {
@@ -85,6 +92,57 @@ func (cc *configHolder) RegisterBool(key string, defValue bool) Bool {
 	return boolHolder{value: &v}
 }
 
+// RegisterDuration register a time.Duration variable
+func RegisterDuration(key string, defValue time.Duration) Duration {
+	return confWatch.RegisterDuration(key, defValue)
+}
+func (cc *configHolder) RegisterDuration(key string, defValue time.Duration) Duration {
+	var v = defValue
+	cc.addRef(key, &v, defValue)
+	return durationHolder{value: &v}
+}
+
+// OnChange register a function that will be called every time configs are (re)loaded,
+// it returns a function that unregister it
+func OnChange(fn func()) func() { return confWatch.OnChange(fn) }
+func (cc *configHolder) OnChange(fn func()) func() {
+	l := &listener{fn: fn}
+
+	cc.lock.Lock()
+	defer cc.lock.Unlock()
+	cc.listeners = append(cc.listeners, l)
+
+	return func() {
+		cc.lock.Lock()
+		defer cc.lock.Unlock()
+
+		// a new slice is built since reload may iterate the old one
+		listeners := make([]*listener, 0, len(cc.listeners))
+		for _, other := range cc.listeners {
+			if other != l {
+				listeners = append(listeners, other)
+			}
+		}
+		cc.listeners = listeners
+	}
+}
+
+func (cc *configHolder) reload() error {
+	if err := cc.handleChange(); err != nil {
+		return err
+	}
+
+	cc.lock.RLock()
+	listeners := make([]*listener, len(cc.listeners))
+	copy(listeners, cc.listeners)
+	cc.lock.RUnlock()
+
+	for _, l := range listeners {
+		l.fn()
+	}
+	return nil
+}
+
 func (cc *configHolder) handleChange() error {
 	cc.lock.RLock()
 	defer cc.lock.RUnlock()
@@ -140,6 +198,13 @@ func (cc *configHolder) handleChange() error {
 			}
 			t := configItem.ref.(*bool)
 			*t = v
+		case time.Duration:
+			v, err := getViperDuration(configItem.key, configItem.defValue.(time.Duration))
+			if err != nil {
+				return err
+			}
+			t := configItem.ref.(*time.Duration)
+			*t = v
 		}
 	}
 	return nil
@@ -148,7 +213,7 @@ func (cc *configHolder) handleChange() error {
 // Load configs and set variables
 // can use to reload configs
 func Load() error {
-	return confWatch.handleChange()
+	return confWatch.reload()
 }
 
 // Init initialize config module with and accept confName that is config filename
@@ -159,5 +224,5 @@ func Load() error {
 // $HOME/.<appName>
 // and beside the executable file
 func Init(confName, ext, appName string) error {
-	return initViper(confName, ext, appName, confWatch.handleChange)
+	return initViper(confName, ext, appName, confWatch.reload)
 }
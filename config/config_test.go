@@ -4,6 +4,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"os"
 	"testing"
+	"time"
 )
 
 var configSample = []byte(`
@@ -13,6 +14,7 @@ server:
   delay: 3.4
   host: 127.0.0.1
   port: 9090
+  timeout: 5s
 db: 
   enable: true
   connection: "postgres://"
@@ -36,6 +38,11 @@ func TestConfig(t *testing.T) {
 	dbEnable := RegisterBool("db.enable", false)
 	dbEngine := RegisterString("db.engine", "")
 	urls := RegisterStringSlice("urls", nil)
+	serverTimeout := RegisterDuration("server.timeout", 0)
+
+	var changed, removed int
+	OnChange(func() { changed++ })
+	unregister := OnChange(func() { removed++ })
 
 	err = Load()
 	assert.Nil(t, err)
@@ -48,11 +55,16 @@ func TestConfig(t *testing.T) {
 	assert.Equal(t, true, dbEnable.Bool())
 	assert.Equal(t, "postgres", dbEngine.String())
 	assert.Equal(t, []string{"url-one", "url-two", "url-three"}, urls.Slice())
+	assert.Equal(t, 5*time.Second, serverTimeout.Duration())
+	assert.Equal(t, 1, changed)
+	assert.Equal(t, 1, removed)
+	unregister()
 
 	// default value
 	notExistString := RegisterString("foo.bar", "foo.bar")
 	notExistInt := RegisterInt64("foo.bar.int", 7)
 	notExistFloat := RegisterFloat64("foo.bar.float", 7.7)
+	notExistDuration := RegisterDuration("foo.bar.duration", time.Minute)
 
 	err = Load()
 	assert.Nil(t, err)
@@ -60,6 +72,9 @@ func TestConfig(t *testing.T) {
 	assert.Equal(t, "foo.bar", notExistString.String())
 	assert.Equal(t, 7, notExistInt.Int())
 	assert.Equal(t, 7.7, notExistFloat.Float64())
+	assert.Equal(t, time.Minute, notExistDuration.Duration())
+	assert.Equal(t, 2, changed)
+	assert.Equal(t, 1, removed)
 
 	err = os.Remove(fileName)
 	assert.Nil(t, err)
@@ -1,5 +1,7 @@
 package config
 
+import "time"
+
 // Int type interface
 type Int interface {
 	Int() int
@@ -27,6 +29,11 @@ type StringSlice interface {
 	Slice() []string
 }
 
+// Duration type interface
+type Duration interface {
+	Duration() time.Duration
+}
+
 type intHolder struct {
 	value *int64
 }
@@ -47,6 +54,10 @@ type stringSliceHolder struct {
 	value *[]string
 }
 
+type durationHolder struct {
+	value *time.Duration
+}
+
 // String will return value of string variable
 func (sh stringHolder) String() string {
 	return *sh.value
@@ -81,3 +92,8 @@ func (bh boolHolder) Bool() bool {
 func (sr stringSliceHolder) Slice() []string {
 	return *sr.value
 }
+
+// Duration will return value of duration variable
+func (dh durationHolder) Duration() time.Duration {
+	return *dh.value
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/viper"
@@ -55,6 +56,14 @@ func getViperBool(key string, defaultValue bool) (bool, error) {
 	return v, nil
 }
 
+func getViperDuration(key string, defaultValue time.Duration) (time.Duration, error) {
+	v := viper.GetDuration(key)
+	if v == 0 {
+		return defaultValue, nil
+	}
+	return v, nil
+}
+
 func initViper(confName, ext, appName string, onChange func() error) error {
 	viper.SetConfigName(confName)                          // name of config file (without extension)
 	viper.SetConfigType(ext)                               // REQUIRED if the config file does not have the extension in the name
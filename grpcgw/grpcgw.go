@@ -24,7 +24,10 @@ type serverOptions struct {
 	httpPort        int
 	grpcPort        int
 	swaggerBaseURL  string
+	livenessURL     string
+	readinessURL    string
 	serveMuxOptions []runtime.ServeMuxOption
+	httpMiddlewares []func(http.Handler) http.Handler
 }
 
 // A ServerOption sets options such as ports, paths parameters, etc.
@@ -67,6 +70,8 @@ var (
 		httpPort:       8080,
 		grpcPort:       9090,
 		swaggerBaseURL: "/v1/swagger",
+		livenessURL:    "/healthz",
+		readinessURL:   "/readyz",
 	}
 )
 
@@ -97,6 +102,20 @@ func SwaggerBaseURL(s string) ServerOption {
 	})
 }
 
+// LivenessURL returns a ServerOption that will apply livenessURL option
+func LivenessURL(s string) ServerOption {
+	return newFuncServerOption(func(o *serverOptions) {
+		o.livenessURL = s
+	})
+}
+
+// ReadinessURL returns a ServerOption that will apply readinessURL option
+func ReadinessURL(s string) ServerOption {
+	return newFuncServerOption(func(o *serverOptions) {
+		o.readinessURL = s
+	})
+}
+
 // ServeMuxOptions returns a ServerOption that will apply ServeMuxOptions option for mux
 func ServeMuxOptions(opts ...runtime.ServeMuxOption) ServerOption {
 	return newFuncServerOption(func(o *serverOptions) {
@@ -104,6 +123,14 @@ func ServeMuxOptions(opts ...runtime.ServeMuxOption) ServerOption {
 	})
 }
 
+// HttpMiddlewares returns a ServerOption that will wrap gateway mux with given http middlewares,
+// first middleware will be the outermost one
+func HttpMiddlewares(mw ...func(http.Handler) http.Handler) ServerOption {
+	return newFuncServerOption(func(o *serverOptions) {
+		o.httpMiddlewares = append(o.httpMiddlewares, mw...)
+	})
+}
+
 // RegisterController register a controller
 func RegisterController(c Controller) {
 	lock.Lock()
@@ -167,12 +194,18 @@ func serveHTTP(ctx context.Context, opts serverOptions) (func() error, error) {
 
 	sw := &swaggerServer{swaggerBaseURL: opts.swaggerBaseURL}
 	normalMux.HandleFunc(opts.swaggerBaseURL, sw.swaggerHandler)
+	normalMux.HandleFunc(opts.livenessURL, livenessHandler)
+	normalMux.HandleFunc(opts.readinessURL, readinessHandler(2*time.Second))
 
 	for i := range controllers {
 		controllers[i].InitRest(ctx, c, mux, normalMux)
 	}
 
-	normalMux.Handle("/", cors.AllowAll().Handler(mux))
+	var handler http.Handler = mux
+	for i := len(opts.httpMiddlewares) - 1; i >= 0; i-- {
+		handler = opts.httpMiddlewares[i](handler)
+	}
+	normalMux.Handle("/", cors.AllowAll().Handler(handler))
 	srv := http.Server{
 		Addr:    httpAddr,
 		Handler: normalMux,
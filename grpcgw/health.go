@@ -0,0 +1,67 @@
+package grpcgw
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/golang-tire/pkg/log"
+)
+
+// ReadinessCheck returns an error when a dependency of server is not ready to serve requests
+type ReadinessCheck func(ctx context.Context) error
+
+var readinessChecks = make(map[string]ReadinessCheck)
+
+// RegisterReadinessCheck register a named readiness check, all checks should pass for
+// readiness endpoint to report server as ready
+func RegisterReadinessCheck(name string, check ReadinessCheck) {
+	lock.Lock()
+	defer lock.Unlock()
+	readinessChecks[name] = check
+}
+
+type healthResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+func writeHealth(w http.ResponseWriter, code int, res healthResponse) {
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		log.Error("serve health response failed", log.Err(err))
+	}
+}
+
+func livenessHandler(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, http.StatusOK, healthResponse{Status: "ok"})
+}
+
+func readinessHandler(timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		lock.RLock()
+		checks := make(map[string]ReadinessCheck, len(readinessChecks))
+		for name, check := range readinessChecks {
+			checks[name] = check
+		}
+		lock.RUnlock()
+
+		res := healthResponse{Status: "ok", Checks: make(map[string]string, len(checks))}
+		code := http.StatusOK
+		for name, check := range checks {
+			if err := check(ctx); err != nil {
+				res.Checks[name] = err.Error()
+				res.Status = "unavailable"
+				code = http.StatusServiceUnavailable
+				continue
+			}
+			res.Checks[name] = "ok"
+		}
+		writeHealth(w, code, res)
+	}
+}
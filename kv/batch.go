@@ -0,0 +1,203 @@
+package kv
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/golang-tire/pkg/log"
+)
+
+type batchOpKind int
+
+const (
+	batchSet batchOpKind = iota
+	batchGet
+	batchDelete
+	batchExpire
+)
+
+type batchOp struct {
+	kind  batchOpKind
+	key   string
+	value interface{}
+	alive time.Duration
+}
+
+// BatchResult is the result of a single queued batch operation
+type BatchResult struct {
+	Key string
+	// Value is only filled for Get operations
+	Value string
+	// Err is ErrNotFound when a Get key does not exist
+	Err error
+}
+
+// Batch queue operations and execute them in a single round trip
+type Batch struct {
+	client *Client
+	tx     bool
+	ops    []batchOp
+}
+
+// Batch returns a new batch that will execute in a pipeline
+func (c *Client) Batch() *Batch {
+	return &Batch{client: c}
+}
+
+// Tx returns a new batch that will execute atomically in a MULTI/EXEC transaction
+func (c *Client) Tx() *Batch {
+	return &Batch{client: c, tx: true}
+}
+
+// Set queue a set operation
+func (b *Batch) Set(key string, val interface{}, alive time.Duration) *Batch {
+	b.ops = append(b.ops, batchOp{kind: batchSet, key: key, value: val, alive: alive})
+	return b
+}
+
+// Get queue a get operation
+func (b *Batch) Get(key string) *Batch {
+	b.ops = append(b.ops, batchOp{kind: batchGet, key: key})
+	return b
+}
+
+// Delete queue a delete operation
+func (b *Batch) Delete(key string) *Batch {
+	b.ops = append(b.ops, batchOp{kind: batchDelete, key: key})
+	return b
+}
+
+// Expire queue an expire operation
+func (b *Batch) Expire(key string, alive time.Duration) *Batch {
+	b.ops = append(b.ops, batchOp{kind: batchExpire, key: key, alive: alive})
+	return b
+}
+
+// Len returns number of queued operations
+func (b *Batch) Len() int {
+	return len(b.ops)
+}
+
+// Exec run all queued operations and returns a result per operation in queued order
+// returned error is the first failed operation error, missing keys are not reported as error
+func (b *Batch) Exec(ctx context.Context) ([]BatchResult, error) {
+	if len(b.ops) == 0 {
+		return nil, nil
+	}
+
+	var pipe redis.Pipeliner
+	if b.tx {
+		pipe = b.client.conn().TxPipeline()
+	} else {
+		pipe = b.client.conn().Pipeline()
+	}
+
+	cmds := make([]redis.Cmder, len(b.ops))
+	for i, op := range b.ops {
+		key := b.client.Key(op.key)
+		switch op.kind {
+		case batchSet:
+			cmds[i] = pipe.Set(ctx, key, op.value, op.alive)
+		case batchGet:
+			cmds[i] = pipe.Get(ctx, key)
+		case batchDelete:
+			cmds[i] = pipe.Del(ctx, key)
+		case batchExpire:
+			cmds[i] = pipe.Expire(ctx, key, op.alive)
+		}
+	}
+
+	_, err := pipe.Exec(ctx)
+	if err == redis.Nil {
+		// exec returns error of first failed command, missing keys are not failures but
+		// commands after them may have failed
+		err = nil
+		for _, cmd := range cmds {
+			if e := cmd.Err(); e != nil && e != redis.Nil {
+				err = e
+				break
+			}
+		}
+	}
+	if err != nil {
+		log.Error("kv: batch error", log.Err(err))
+	}
+
+	results := make([]BatchResult, len(b.ops))
+	for i, op := range b.ops {
+		results[i] = BatchResult{Key: op.key, Err: notFound(cmds[i].Err())}
+		if sc, ok := cmds[i].(*redis.StringCmd); ok && results[i].Err == nil {
+			results[i].Value = sc.Val()
+		}
+	}
+	return results, err
+}
+
+// MGet read multiple keys in one round trip, missing keys are not present in returned map
+func (c *Client) MGet(ctx context.Context, keys ...string) (map[string]string, error) {
+	res := make(map[string]string, len(keys))
+	if len(keys) == 0 {
+		return res, nil
+	}
+
+	vals, err := c.conn().MGet(ctx, c.keys(keys)...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i, v := range vals {
+		if s, ok := v.(string); ok {
+			res[keys[i]] = s
+		}
+	}
+	return res, nil
+}
+
+// MSet write multiple keys in one round trip, if alive is not zero all keys will expire after it
+func (c *Client) MSet(ctx context.Context, values map[string]interface{}, alive time.Duration) error {
+	if len(values) == 0 {
+		return nil
+	}
+
+	var err error
+	if alive == 0 {
+		pairs := make([]interface{}, 0, len(values)*2)
+		for k, v := range values {
+			pairs = append(pairs, c.Key(k), v)
+		}
+		err = c.conn().MSet(ctx, pairs...).Err()
+	} else {
+		b := c.Batch()
+		for k, v := range values {
+			b.Set(k, v, alive)
+		}
+		_, err = b.Exec(ctx)
+	}
+
+	if err != nil {
+		log.Error("kv: write error", log.Err(err))
+	}
+	return err
+}
+
+// MDelete remove multiple keys in one round trip and returns number of removed keys
+func (c *Client) MDelete(ctx context.Context, keys ...string) (int64, error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	n, err := c.conn().Del(ctx, c.keys(keys)...).Result()
+	if err != nil {
+		log.Error("kv: delete key error", log.Err(err))
+		return 0, err
+	}
+	return n, nil
+}
+
+// notFound map redis.Nil to ErrNotFound
+func notFound(err error) error {
+	if err == redis.Nil {
+		return ErrNotFound
+	}
+	return err
+}
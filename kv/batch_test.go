@@ -0,0 +1,72 @@
+package kv
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMSetMGetMDelete(t *testing.T) {
+	ctx := context.Background()
+	client, err := Init(ctx, testConfig)
+	assert.Nil(t, err)
+
+	err = client.MSet(ctx, map[string]interface{}{"m1": "v1", "m2": "v2"}, 0)
+	assert.Nil(t, err)
+
+	err = client.MSet(ctx, map[string]interface{}{"m3": "v3"}, time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Minute, redisServer.TTL("m3"))
+
+	vals, err := client.MGet(ctx, "m1", "m2", "m3", "missing")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"m1": "v1", "m2": "v2", "m3": "v3"}, vals)
+
+	n, err := client.MDelete(ctx, "m1", "m2", "missing")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+
+	vals, err = client.MGet(ctx, "m1", "m2", "m3")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"m3": "v3"}, vals)
+}
+
+func TestBatch(t *testing.T) {
+	ctx := context.Background()
+	client, err := Init(ctx, testConfig)
+	assert.Nil(t, err)
+
+	for _, b := range []*Batch{client.Batch(), client.Tx()} {
+		b.Set("b1", "v1", time.Minute).
+			Get("b1").
+			Get("b-missing").
+			Delete("b1").
+			Get("b1")
+		assert.Equal(t, 5, b.Len())
+
+		res, err := b.Exec(ctx)
+		assert.Nil(t, err)
+		assert.Len(t, res, 5)
+
+		assert.Nil(t, res[0].Err)
+		assert.Equal(t, "v1", res[1].Value)
+		assert.Equal(t, ErrNotFound, res[2].Err)
+		assert.Equal(t, "b-missing", res[2].Key)
+		assert.Nil(t, res[3].Err)
+		assert.Equal(t, ErrNotFound, res[4].Err)
+	}
+
+	res, err := client.Batch().Exec(ctx)
+	assert.Nil(t, err)
+	assert.Nil(t, res)
+
+	// a missing key does not hide failure of a later command
+	assert.Nil(t, client.Hash("b-hash").Set(ctx, "f", "v"))
+	res, err = client.Batch().Get("b-missing").Get("b-hash").Exec(ctx)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "WRONGTYPE")
+	assert.Equal(t, ErrNotFound, res[0].Err)
+	assert.Equal(t, err, res[1].Err)
+}
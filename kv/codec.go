@@ -0,0 +1,99 @@
+package kv
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// Codec encode and decode values stored in redis data structures
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSONCodec is a Codec that use encoding/json, it's the default client codec
+type JSONCodec struct{}
+
+// Marshal implements Codec
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal implements Codec
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// SetCodec set codec of data structure values, it should be called before client is in use
+func (c *Client) SetCodec(codec Codec) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.codec = codec
+}
+
+func (c *Client) getCodec() Codec {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if c.codec == nil {
+		return JSONCodec{}
+	}
+	return c.codec
+}
+
+// encode marshal v using client codec, strings and byte slices are stored as is
+func (c *Client) encode(v interface{}) (interface{}, error) {
+	switch t := v.(type) {
+	case string:
+		return t, nil
+	case []byte:
+		return t, nil
+	}
+	b, err := c.getCodec().Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (c *Client) encodeAll(values []interface{}) ([]interface{}, error) {
+	res := make([]interface{}, len(values))
+	for i := range values {
+		v, err := c.encode(values[i])
+		if err != nil {
+			return nil, err
+		}
+		res[i] = v
+	}
+	return res, nil
+}
+
+// decode unmarshal data into out using client codec, *string and *[]byte are filled as is
+func (c *Client) decode(data string, out interface{}) error {
+	switch t := out.(type) {
+	case *string:
+		*t = data
+		return nil
+	case *[]byte:
+		*t = []byte(data)
+		return nil
+	}
+	return c.getCodec().Unmarshal([]byte(data), out)
+}
+
+// decodeSlice decode each value into a new element of slice pointed by out
+func (c *Client) decodeSlice(values []string, out interface{}) error {
+	rv := reflect.ValueOf(out)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("kv: out should be a pointer to slice, got %T", out)
+	}
+
+	slice := reflect.MakeSlice(rv.Elem().Type(), len(values), len(values))
+	for i := range values {
+		if err := c.decode(values[i], slice.Index(i).Addr().Interface()); err != nil {
+			return err
+		}
+	}
+	rv.Elem().Set(slice)
+	return nil
+}
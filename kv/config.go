@@ -0,0 +1,112 @@
+package kv
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/golang-tire/pkg/config"
+	"github.com/golang-tire/pkg/log"
+)
+
+// ConfigLoader hold redis settings registered in config package
+type ConfigLoader struct {
+	host         config.String
+	port         config.Int
+	password     config.String
+	db           config.Int
+	poolSize     config.Int
+	minIdleConns config.Int
+	dialTimeout  config.Duration
+	readTimeout  config.Duration
+	writeTimeout config.Duration
+	tls          config.Bool
+	tlsSkip      config.Bool
+	tlsName      config.String
+	namespace    config.String
+}
+
+// ConfigFromPrefix register redis settings under given prefix in config package
+// e.g. for prefix "redis" these keys will be registered:
+// redis.host, redis.port, redis.password, redis.db,
+// redis.pool_size, redis.min_idle_conns,
+// redis.dial_timeout, redis.read_timeout, redis.write_timeout,
+// redis.tls.enable, redis.tls.insecure_skip_verify, redis.tls.server_name,
+// redis.namespace
+func ConfigFromPrefix(prefix string) *ConfigLoader {
+	key := func(k string) string {
+		if prefix == "" {
+			return k
+		}
+		return prefix + "." + k
+	}
+
+	return &ConfigLoader{
+		host:         config.RegisterString(key("host"), "localhost"),
+		port:         config.RegisterInt(key("port"), 6379),
+		password:     config.RegisterString(key("password"), ""),
+		db:           config.RegisterInt(key("db"), 0),
+		poolSize:     config.RegisterInt(key("pool_size"), 10*runtime.GOMAXPROCS(0)),
+		minIdleConns: config.RegisterInt(key("min_idle_conns"), 0),
+		dialTimeout:  config.RegisterDuration(key("dial_timeout"), 5*time.Second),
+		readTimeout:  config.RegisterDuration(key("read_timeout"), 3*time.Second),
+		writeTimeout: config.RegisterDuration(key("write_timeout"), 3*time.Second),
+		tls:          config.RegisterBool(key("tls.enable"), false),
+		tlsSkip:      config.RegisterBool(key("tls.insecure_skip_verify"), false),
+		tlsName:      config.RegisterString(key("tls.server_name"), ""),
+		namespace:    config.RegisterString(key("namespace"), ""),
+	}
+}
+
+// Config return a kv config filled with current loaded values
+func (l *ConfigLoader) Config() *Config {
+	return &Config{
+		Host:                  l.host.String(),
+		Port:                  l.port.Int(),
+		Password:              l.password.String(),
+		DB:                    l.db.Int(),
+		PoolSize:              l.poolSize.Int(),
+		MinIdleConns:          l.minIdleConns.Int(),
+		DialTimeout:           l.dialTimeout.Duration(),
+		ReadTimeout:           l.readTimeout.Duration(),
+		WriteTimeout:          l.writeTimeout.Duration(),
+		TLS:                   l.tls.Bool(),
+		TLSInsecureSkipVerify: l.tlsSkip.Bool(),
+		TLSServerName:         l.tlsName.String(),
+		Namespace:             l.namespace.String(),
+	}
+}
+
+// Watch will reconnect the client every time config reloads and redis settings are changed
+// watching stops when ctx is done
+func (l *ConfigLoader) Watch(ctx context.Context, c *Client) {
+	var lock sync.Mutex
+	current := *l.Config()
+	unregister := config.OnChange(func() {
+		// listener may be called while it's being unregistered
+		if ctx.Err() != nil {
+			return
+		}
+
+		lock.Lock()
+		defer lock.Unlock()
+
+		next := *l.Config()
+		if next == current {
+			return
+		}
+
+		if err := c.reconnect(ctx, &next); err != nil {
+			log.Error("kv: reconnect error", log.Err(err))
+			return
+		}
+		current = next
+		log.Info("kv: reconnected with new config", log.String("addr", c.conn().Options().Addr))
+	})
+
+	go func() {
+		<-ctx.Done()
+		unregister()
+	}()
+}
@@ -0,0 +1,50 @@
+package kv
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/golang-tire/pkg/config"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigFromPrefix(t *testing.T) {
+	loader := ConfigFromPrefix("kvtest")
+
+	viper.Set("kvtest.host", redisServer.Host())
+	viper.Set("kvtest.port", redisServer.Port())
+	viper.Set("kvtest.read_timeout", "1s")
+	assert.Nil(t, config.Load())
+
+	cfg := loader.Config()
+	assert.Equal(t, redisServer.Host(), cfg.Host)
+	assert.Equal(t, redisServer.Port(), strconv.Itoa(cfg.Port))
+	assert.Equal(t, time.Second, cfg.ReadTimeout)
+	assert.Equal(t, 3*time.Second, cfg.WriteTimeout)
+	assert.False(t, cfg.TLS)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client, err := Init(ctx, cfg)
+	assert.Nil(t, err)
+	loader.Watch(ctx, client)
+
+	otherServer, err := miniredis.Run()
+	assert.Nil(t, err)
+	defer otherServer.Close()
+
+	viper.Set("kvtest.port", otherServer.Port())
+	assert.Nil(t, config.Load())
+
+	err = client.Set("reconnected", "yes", time.Minute)
+	assert.Nil(t, err)
+
+	v, err := otherServer.Get("reconnected")
+	assert.Nil(t, err)
+	assert.Equal(t, "yes", v)
+}
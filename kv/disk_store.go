@@ -0,0 +1,489 @@
+package kv
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang-tire/pkg/log"
+)
+
+// ErrClosed is returned when disk store is used after close
+var ErrClosed = errors.New("kv: store is closed")
+
+const (
+	diskOpSet byte = 1
+	diskOpDel byte = 2
+
+	// crc(4) + op(1) + expiresAt(8) + keyLen(4) + valueLen(4)
+	diskHeaderSize = 21
+)
+
+type diskOptions struct {
+	syncWrites      bool
+	compactRatio    float64
+	compactMinSize  int64
+	compactInterval time.Duration
+}
+
+// A DiskOption sets options such as fsync and compaction of disk store
+type DiskOption interface {
+	apply(*diskOptions)
+}
+
+// funcDiskOption wraps a function that modifies diskOptions into an
+// implementation of the DiskOption interface.
+type funcDiskOption struct {
+	f func(*diskOptions)
+}
+
+func (fdo *funcDiskOption) apply(do *diskOptions) {
+	fdo.f(do)
+}
+
+func newFuncDiskOption(f func(*diskOptions)) *funcDiskOption {
+	return &funcDiskOption{
+		f: f,
+	}
+}
+
+// SyncWrites returns a DiskOption that fsync the log after every write
+func SyncWrites(b bool) DiskOption {
+	return newFuncDiskOption(func(o *diskOptions) {
+		o.syncWrites = b
+	})
+}
+
+// CompactRatio returns a DiskOption that set ratio of dead bytes in log that trigger compaction
+func CompactRatio(r float64) DiskOption {
+	return newFuncDiskOption(func(o *diskOptions) {
+		o.compactRatio = r
+	})
+}
+
+// CompactMinSize returns a DiskOption that set minimum log size before compaction is considered
+func CompactMinSize(n int64) DiskOption {
+	return newFuncDiskOption(func(o *diskOptions) {
+		o.compactMinSize = n
+	})
+}
+
+// CompactInterval returns a DiskOption that set how often expired keys are purged and
+// compaction is checked in background, zero disables it
+func CompactInterval(d time.Duration) DiskOption {
+	return newFuncDiskOption(func(o *diskOptions) {
+		o.compactInterval = d
+	})
+}
+
+type diskEntry struct {
+	offset    int64
+	size      int64
+	keyLen    int64
+	valueLen  int64
+	expiresAt int64
+}
+
+func (e diskEntry) expired(now time.Time) bool {
+	return e.expiresAt != 0 && now.UnixNano() > e.expiresAt
+}
+
+// DiskStore is an embedded Store backed by an append only log file, every write is appended
+// to the log and an in memory index keep offset of live values, the log is rewritten
+// without dead records when they pass compact ratio
+type DiskStore struct {
+	lock  sync.RWMutex
+	opts  diskOptions
+	path  string
+	file  *os.File
+	index map[string]diskEntry
+	size  int64
+	live  int64
+}
+
+// OpenDisk open or create a disk store at path, store will close when ctx is done
+func OpenDisk(ctx context.Context, path string, opts ...DiskOption) (*DiskStore, error) {
+	o := diskOptions{
+		compactRatio:    0.5,
+		compactMinSize:  1 << 20,
+		compactInterval: time.Minute,
+	}
+	for _, opt := range opts {
+		opt.apply(&o)
+	}
+
+	d := &DiskStore{
+		opts:  o,
+		path:  path,
+		index: make(map[string]diskEntry),
+	}
+	if err := d.load(); err != nil {
+		return nil, err
+	}
+
+	go func() {
+		var tick <-chan time.Time
+		if o.compactInterval > 0 {
+			ticker := time.NewTicker(o.compactInterval)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				if err := d.Close(); err != nil && err != ErrClosed {
+					log.Error("kv: close disk store failed", log.Err(err))
+				}
+				return
+			case <-tick:
+				d.purgeExpired()
+				if err := d.maybeCompact(); err != nil {
+					log.Error("kv: compact disk store failed", log.Err(err))
+				}
+			}
+		}
+	}()
+	return d, nil
+}
+
+// load open log file and rebuild index, a corrupted or partial tail is truncated
+func (d *DiskStore) load() error {
+	f, err := os.OpenFile(d.path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	var (
+		r      = bufio.NewReader(f)
+		offset int64
+		now    = time.Now()
+	)
+	for {
+		op, key, _, e, err := readDiskRecord(r, info.Size()-offset)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Error("kv: disk store log is corrupted, truncating", log.String("path", d.path), log.Err(err))
+			if err := f.Truncate(offset); err != nil {
+				_ = f.Close()
+				return err
+			}
+			break
+		}
+
+		e.offset = offset
+		offset += e.size
+		d.drop(key)
+		if op == diskOpSet && !e.expired(now) {
+			d.index[key] = e
+			d.live += e.size
+		}
+	}
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		_ = f.Close()
+		return err
+	}
+	d.file = f
+	d.size = offset
+	return nil
+}
+
+// readDiskRecord read next record of log, remaining is size of log after record offset and
+// bounds record lengths so a corrupted header does not cause a huge allocation
+func readDiskRecord(r io.Reader, remaining int64) (byte, string, []byte, diskEntry, error) {
+	var e diskEntry
+	header := make([]byte, diskHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return 0, "", nil, e, errors.New("partial record header")
+		}
+		return 0, "", nil, e, err
+	}
+
+	op := header[4]
+	e.expiresAt = int64(binary.LittleEndian.Uint64(header[5:13]))
+	e.keyLen = int64(binary.LittleEndian.Uint32(header[13:17]))
+	e.valueLen = int64(binary.LittleEndian.Uint32(header[17:21]))
+	e.size = diskHeaderSize + e.keyLen + e.valueLen
+	if op != diskOpSet && op != diskOpDel {
+		return 0, "", nil, e, errors.New("invalid record operation")
+	}
+	if e.size > remaining {
+		return 0, "", nil, e, errors.New("record length exceeds log size")
+	}
+
+	body := make([]byte, e.keyLen+e.valueLen)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, "", nil, e, errors.New("partial record body")
+	}
+
+	crc := crc32.NewIEEE()
+	_, _ = crc.Write(header[4:])
+	_, _ = crc.Write(body)
+	if crc.Sum32() != binary.LittleEndian.Uint32(header[:4]) {
+		return 0, "", nil, e, errors.New("record checksum mismatch")
+	}
+	return op, string(body[:e.keyLen]), body[e.keyLen:], e, nil
+}
+
+func encodeDiskRecord(op byte, key, value string, expiresAt int64) []byte {
+	buf := make([]byte, diskHeaderSize+len(key)+len(value))
+	buf[4] = op
+	binary.LittleEndian.PutUint64(buf[5:13], uint64(expiresAt))
+	binary.LittleEndian.PutUint32(buf[13:17], uint32(len(key)))
+	binary.LittleEndian.PutUint32(buf[17:21], uint32(len(value)))
+	copy(buf[diskHeaderSize:], key)
+	copy(buf[diskHeaderSize+len(key):], value)
+	binary.LittleEndian.PutUint32(buf[:4], crc32.ChecksumIEEE(buf[4:]))
+	return buf
+}
+
+// drop remove key from index and live size
+func (d *DiskStore) drop(key string) {
+	if old, ok := d.index[key]; ok {
+		d.live -= old.size
+		delete(d.index, key)
+	}
+}
+
+// appendRecord write a record at end of log, lock should be held
+func (d *DiskStore) appendRecord(op byte, key, value string, expiresAt int64) (diskEntry, error) {
+	if d.file == nil {
+		return diskEntry{}, ErrClosed
+	}
+
+	buf := encodeDiskRecord(op, key, value, expiresAt)
+	if _, err := d.file.Write(buf); err != nil {
+		return diskEntry{}, err
+	}
+	if d.opts.syncWrites {
+		if err := d.file.Sync(); err != nil {
+			return diskEntry{}, err
+		}
+	}
+
+	e := diskEntry{
+		offset:    d.size,
+		size:      int64(len(buf)),
+		keyLen:    int64(len(key)),
+		valueLen:  int64(len(value)),
+		expiresAt: expiresAt,
+	}
+	d.size += e.size
+	return e, nil
+}
+
+func (d *DiskStore) set(key, value string, ttl time.Duration) error {
+	var expiresAt int64
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl).UnixNano()
+	}
+
+	e, err := d.appendRecord(diskOpSet, key, value, expiresAt)
+	if err != nil {
+		return err
+	}
+	d.drop(key)
+	d.index[key] = e
+	d.live += e.size
+	return nil
+}
+
+// Get implements Store
+func (d *DiskStore) Get(ctx context.Context, key string) (string, error) {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	if d.file == nil {
+		return "", ErrClosed
+	}
+
+	e, ok := d.index[key]
+	if !ok || e.expired(time.Now()) {
+		return "", ErrNotFound
+	}
+
+	buf := make([]byte, e.valueLen)
+	if _, err := d.file.ReadAt(buf, e.offset+diskHeaderSize+e.keyLen); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// Set implements Store
+func (d *DiskStore) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if err := d.set(key, value, ttl); err != nil {
+		return err
+	}
+	return d.compactIfNeeded()
+}
+
+// SetNX implements Store
+func (d *DiskStore) SetNX(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if e, ok := d.index[key]; ok && !e.expired(time.Now()) {
+		return false, nil
+	}
+	if err := d.set(key, value, ttl); err != nil {
+		return false, err
+	}
+	return true, d.compactIfNeeded()
+}
+
+// Delete implements Store
+func (d *DiskStore) Delete(ctx context.Context, keys ...string) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	for _, key := range keys {
+		if _, ok := d.index[key]; !ok {
+			continue
+		}
+		if _, err := d.appendRecord(diskOpDel, key, "", 0); err != nil {
+			return err
+		}
+		d.drop(key)
+	}
+	return d.compactIfNeeded()
+}
+
+// Len returns number of keys, it may include expired keys not purged yet
+func (d *DiskStore) Len() int {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	return len(d.index)
+}
+
+// Size returns size of log file in bytes
+func (d *DiskStore) Size() int64 {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	return d.size
+}
+
+func (d *DiskStore) purgeExpired() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	now := time.Now()
+	for key, e := range d.index {
+		if e.expired(now) {
+			d.drop(key)
+		}
+	}
+}
+
+func (d *DiskStore) maybeCompact() error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.compactIfNeeded()
+}
+
+func (d *DiskStore) compactIfNeeded() error {
+	if d.file == nil || d.size < d.opts.compactMinSize {
+		return nil
+	}
+	if float64(d.size-d.live)/float64(d.size) < d.opts.compactRatio {
+		return nil
+	}
+	return d.compact()
+}
+
+// Compact rewrite log file with only live records
+func (d *DiskStore) Compact() error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.compact()
+}
+
+func (d *DiskStore) compact() error {
+	if d.file == nil {
+		return ErrClosed
+	}
+
+	tmpPath := d.path + ".compact"
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	var (
+		w      = bufio.NewWriter(tmp)
+		index  = make(map[string]diskEntry, len(d.index))
+		offset int64
+		now    = time.Now()
+	)
+	for key, e := range d.index {
+		if e.expired(now) {
+			continue
+		}
+
+		buf := make([]byte, e.size)
+		if _, err := d.file.ReadAt(buf, e.offset); err != nil {
+			_ = tmp.Close()
+			return err
+		}
+		if _, err := w.Write(buf); err != nil {
+			_ = tmp.Close()
+			return err
+		}
+		e.offset = offset
+		offset += e.size
+		index[key] = e
+	}
+
+	if err := w.Flush(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := os.Rename(tmpPath, d.path); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+
+	_ = d.file.Close()
+	d.file = tmp
+	d.index = index
+	d.size = offset
+	d.live = offset
+	return nil
+}
+
+// Close sync and close log file
+func (d *DiskStore) Close() error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.file == nil {
+		return ErrClosed
+	}
+	err := d.file.Sync()
+	if cErr := d.file.Close(); err == nil {
+		err = cErr
+	}
+	d.file = nil
+	return err
+}
@@ -0,0 +1,160 @@
+package kv
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiskStore(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "kv.log")
+	ctx := context.Background()
+
+	d, err := OpenDisk(ctx, path, CompactInterval(0))
+	assert.Nil(t, err)
+
+	assert.Nil(t, d.Set(ctx, "a", "1", 0))
+	assert.Nil(t, d.Set(ctx, "b", "2", 0))
+	assert.Nil(t, d.Set(ctx, "a", "3", 0))
+	assert.Nil(t, d.Set(ctx, "short", "x", time.Millisecond))
+	assert.Nil(t, d.Delete(ctx, "b", "missing"))
+
+	ok, err := d.SetNX(ctx, "a", "4", 0)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	ok, err = d.SetNX(ctx, "lock", "owner", time.Minute)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	v, err := d.Get(ctx, "a")
+	assert.Nil(t, err)
+	assert.Equal(t, "3", v)
+	_, err = d.Get(ctx, "b")
+	assert.Equal(t, ErrNotFound, err)
+
+	time.Sleep(5 * time.Millisecond)
+	_, err = d.Get(ctx, "short")
+	assert.Equal(t, ErrNotFound, err)
+
+	assert.Nil(t, d.Close())
+	_, err = d.Get(ctx, "a")
+	assert.Equal(t, ErrClosed, err)
+
+	// reopen and check persisted data
+	d, err = OpenDisk(ctx, path, CompactInterval(0))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, d.Len())
+	v, err = d.Get(ctx, "a")
+	assert.Nil(t, err)
+	assert.Equal(t, "3", v)
+	v, err = d.Get(ctx, "lock")
+	assert.Nil(t, err)
+	assert.Equal(t, "owner", v)
+
+	before := d.Size()
+	assert.Nil(t, d.Compact())
+	assert.Less(t, d.Size(), before)
+	assert.Nil(t, d.Set(ctx, "c", "5", 0))
+	assert.Nil(t, d.Close())
+
+	d, err = OpenDisk(ctx, path, CompactInterval(0))
+	assert.Nil(t, err)
+	for k, want := range map[string]string{"a": "3", "lock": "owner", "c": "5"} {
+		v, err := d.Get(ctx, k)
+		assert.Nil(t, err)
+		assert.Equal(t, want, v)
+	}
+	assert.Nil(t, d.Close())
+}
+
+func TestDiskStoreAutoCompact(t *testing.T) {
+	ctx := context.Background()
+	d, err := OpenDisk(ctx, filepath.Join(t.TempDir(), "kv.log"), CompactMinSize(100), CompactRatio(0.5), CompactInterval(0))
+	assert.Nil(t, err)
+
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, d.Set(ctx, "key", "some value", 0))
+	}
+	assert.Less(t, d.Size(), int64(100+diskRecordSize("key", "some value")))
+
+	v, err := d.Get(ctx, "key")
+	assert.Nil(t, err)
+	assert.Equal(t, "some value", v)
+}
+
+func TestDiskStoreCorruptedTail(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "kv.log")
+
+	d, err := OpenDisk(ctx, path, CompactInterval(0))
+	assert.Nil(t, err)
+	assert.Nil(t, d.Set(ctx, "a", "1", 0))
+	assert.Nil(t, d.Set(ctx, "b", "2", 0))
+	size := d.Size()
+	assert.Nil(t, d.Close())
+
+	// simulate a crash in the middle of a write
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	assert.Nil(t, err)
+	_, err = f.Write(encodeDiskRecord(diskOpSet, "c", "3", 0)[:10])
+	assert.Nil(t, err)
+	assert.Nil(t, f.Close())
+
+	d, err = OpenDisk(ctx, path, CompactInterval(0))
+	assert.Nil(t, err)
+	assert.Equal(t, size, d.Size())
+	assert.Equal(t, 2, d.Len())
+	assert.Nil(t, d.Set(ctx, "c", "3", 0))
+	assert.Nil(t, d.Close())
+
+	d, err = OpenDisk(ctx, path, CompactInterval(0))
+	assert.Nil(t, err)
+	v, err := d.Get(ctx, "c")
+	assert.Nil(t, err)
+	assert.Equal(t, "3", v)
+}
+
+func TestDiskStoreCorruptedLength(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "kv.log")
+
+	d, err := OpenDisk(ctx, path, CompactInterval(0))
+	assert.Nil(t, err)
+	assert.Nil(t, d.Set(ctx, "a", "1", 0))
+	size := d.Size()
+	assert.Nil(t, d.Close())
+
+	// header of a partial record with corrupted lengths must not be allocated
+	header := encodeDiskRecord(diskOpSet, "b", "2", 0)[:diskHeaderSize]
+	binary.LittleEndian.PutUint32(header[13:17], math.MaxUint32)
+	binary.LittleEndian.PutUint32(header[17:21], math.MaxUint32)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	assert.Nil(t, err)
+	_, err = f.Write(header)
+	assert.Nil(t, err)
+	assert.Nil(t, f.Close())
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	d, err = OpenDisk(ctx, path, CompactInterval(0))
+	runtime.ReadMemStats(&after)
+	assert.Nil(t, err)
+	assert.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(1<<20))
+	assert.Equal(t, size, d.Size())
+	v, err := d.Get(ctx, "a")
+	assert.Nil(t, err)
+	assert.Equal(t, "1", v)
+	assert.Nil(t, d.Close())
+}
+
+func diskRecordSize(key, value string) int {
+	return diskHeaderSize + len(key) + len(value)
+}
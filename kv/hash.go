@@ -0,0 +1,139 @@
+package kv
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Hash is a wrapper of redis hash, field values are encoded using client codec
+type Hash struct {
+	structure
+}
+
+// Hash returns a wrapper of redis hash stored at key
+func (c *Client) Hash(key string) *Hash {
+	return &Hash{structure: newStructure(c, key)}
+}
+
+// Set set value of a field
+func (h *Hash) Set(ctx context.Context, field string, value interface{}) error {
+	v, err := h.client.encode(value)
+	if err != nil {
+		return err
+	}
+	return h.client.conn().HSet(ctx, h.key, field, v).Err()
+}
+
+// Get read value of a field into out, it returns ErrNotFound if field does not exist
+func (h *Hash) Get(ctx context.Context, field string, out interface{}) error {
+	v, err := h.client.conn().HGet(ctx, h.key, field).Result()
+	if err != nil {
+		return notFound(err)
+	}
+	return h.client.decode(v, out)
+}
+
+// SetStruct store exported fields of a struct as hash fields, field names can be
+// changed using `kv:"name"` tag and `kv:"-"` will skip a field
+func (h *Hash) SetStruct(ctx context.Context, v interface{}) error {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("kv: SetStruct needs a struct, got %T", v)
+	}
+
+	var values []interface{}
+	for _, f := range structFields(rv.Type()) {
+		ev, err := h.client.encode(rv.Field(f.index).Interface())
+		if err != nil {
+			return err
+		}
+		values = append(values, f.name, ev)
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	return h.client.conn().HSet(ctx, h.key, values...).Err()
+}
+
+// GetAll read all fields into out that can be a pointer to struct or a *map[string]string
+// it returns ErrNotFound if hash does not exist
+func (h *Hash) GetAll(ctx context.Context, out interface{}) error {
+	values, err := h.client.conn().HGetAll(ctx, h.key).Result()
+	if err != nil {
+		return err
+	}
+	if len(values) == 0 {
+		return ErrNotFound
+	}
+
+	if m, ok := out.(*map[string]string); ok {
+		*m = values
+		return nil
+	}
+
+	rv := reflect.ValueOf(out)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("kv: GetAll needs a pointer to struct, got %T", out)
+	}
+	rv = rv.Elem()
+	for _, f := range structFields(rv.Type()) {
+		v, ok := values[f.name]
+		if !ok {
+			continue
+		}
+		if err := h.client.decode(v, rv.Field(f.index).Addr().Interface()); err != nil {
+			return fmt.Errorf("kv: decode field %s failed: %w", f.name, err)
+		}
+	}
+	return nil
+}
+
+// Delete remove fields from hash
+func (h *Hash) Delete(ctx context.Context, fields ...string) error {
+	return h.client.conn().HDel(ctx, h.key, fields...).Err()
+}
+
+// Exists check if a field exists
+func (h *Hash) Exists(ctx context.Context, field string) (bool, error) {
+	return h.client.conn().HExists(ctx, h.key, field).Result()
+}
+
+// Len returns number of fields
+func (h *Hash) Len(ctx context.Context) (int64, error) {
+	return h.client.conn().HLen(ctx, h.key).Result()
+}
+
+// Incr increment an integer field by n and returns the new value
+func (h *Hash) Incr(ctx context.Context, field string, n int64) (int64, error) {
+	return h.client.conn().HIncrBy(ctx, h.key, field, n).Result()
+}
+
+type structField struct {
+	name  string
+	index int
+}
+
+func structFields(t reflect.Type) []structField {
+	var fields []structField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+
+		name := f.Name
+		if tag, ok := f.Tag.Lookup("kv"); ok {
+			tag = strings.Split(tag, ",")[0]
+			if tag == "-" {
+				continue
+			}
+			if tag != "" {
+				name = tag
+			}
+		}
+		fields = append(fields, structField{name: name, index: i})
+	}
+	return fields
+}
@@ -0,0 +1,67 @@
+package kv
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHash(t *testing.T) {
+	ctx := context.Background()
+	client, err := Init(ctx, testConfig)
+	assert.Nil(t, err)
+
+	type address struct {
+		City string
+	}
+	type user struct {
+		Name    string `kv:"name"`
+		Age     int    `kv:"age"`
+		Address address
+		Secret  string `kv:"-"`
+		private string
+	}
+
+	h := client.Hash("user:1")
+	err = h.SetStruct(ctx, user{Name: "john", Age: 30, Address: address{City: "paris"}, Secret: "s", private: "p"})
+	assert.Nil(t, err)
+
+	raw, err := redisServer.HKeys("user:1")
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"name", "age", "Address"}, raw)
+	assert.Equal(t, "john", redisServer.HGet("user:1", "name"))
+
+	var u user
+	err = h.GetAll(ctx, &u)
+	assert.Nil(t, err)
+	assert.Equal(t, user{Name: "john", Age: 30, Address: address{City: "paris"}}, u)
+
+	var m map[string]string
+	err = h.GetAll(ctx, &m)
+	assert.Nil(t, err)
+	assert.Equal(t, "30", m["age"])
+
+	var age int
+	assert.Nil(t, h.Get(ctx, "age", &age))
+	assert.Equal(t, 30, age)
+
+	n, err := h.Incr(ctx, "age", 2)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(32), n)
+
+	assert.Equal(t, ErrNotFound, h.Get(ctx, "missing", &age))
+
+	ok, err := h.Exists(ctx, "name")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	assert.Nil(t, h.Delete(ctx, "name"))
+	l, err := h.Len(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), l)
+
+	assert.Nil(t, h.Clear(ctx))
+	assert.Equal(t, ErrNotFound, h.GetAll(ctx, &u))
+	assert.NotNil(t, h.GetAll(ctx, u))
+}
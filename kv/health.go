@@ -0,0 +1,274 @@
+package kv
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/golang-tire/pkg/log"
+)
+
+var (
+	// ErrCircuitOpen is returned without calling redis when circuit breaker is open
+	ErrCircuitOpen = errors.New("kv: circuit breaker is open")
+
+	// ErrUnhealthy is returned by readiness check when redis is not healthy
+	ErrUnhealthy = errors.New("kv: redis is not healthy")
+)
+
+type healthOptions struct {
+	interval         time.Duration
+	timeout          time.Duration
+	failureThreshold int
+	openTimeout      time.Duration
+}
+
+// A HealthOption sets options such as check interval and circuit breaker thresholds
+type HealthOption interface {
+	apply(*healthOptions)
+}
+
+// funcHealthOption wraps a function that modifies healthOptions into an
+// implementation of the HealthOption interface.
+type funcHealthOption struct {
+	f func(*healthOptions)
+}
+
+func (fho *funcHealthOption) apply(ho *healthOptions) {
+	fho.f(ho)
+}
+
+func newFuncHealthOption(f func(*healthOptions)) *funcHealthOption {
+	return &funcHealthOption{
+		f: f,
+	}
+}
+
+// CheckInterval returns a HealthOption that set how often redis is pinged
+func CheckInterval(d time.Duration) HealthOption {
+	return newFuncHealthOption(func(o *healthOptions) {
+		o.interval = d
+	})
+}
+
+// CheckTimeout returns a HealthOption that set timeout of each ping
+func CheckTimeout(d time.Duration) HealthOption {
+	return newFuncHealthOption(func(o *healthOptions) {
+		o.timeout = d
+	})
+}
+
+// FailureThreshold returns a HealthOption that set number of consecutive failures that open the circuit
+func FailureThreshold(n int) HealthOption {
+	return newFuncHealthOption(func(o *healthOptions) {
+		o.failureThreshold = n
+	})
+}
+
+// OpenTimeout returns a HealthOption that set how long circuit stays open before a probe is allowed
+func OpenTimeout(d time.Duration) HealthOption {
+	return newFuncHealthOption(func(o *healthOptions) {
+		o.openTimeout = d
+	})
+}
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// breaker is a circuit breaker hook, it fails fast after repeated connection errors
+// and let a single probe command pass after open timeout
+type breaker struct {
+	lock        sync.Mutex
+	opts        healthOptions
+	state       breakerState
+	failures    int
+	openedAt    time.Time
+	probing     bool
+	lastPingErr error
+}
+
+func (b *breaker) allow() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.opts.openTimeout {
+			return ErrCircuitOpen
+		}
+		b.state = breakerHalfOpen
+		b.probing = true
+		return nil
+	case breakerHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+func (b *breaker) done(err error) {
+	if err == ErrCircuitOpen {
+		return
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if errors.Is(err, context.Canceled) {
+		// redis may not be reached, so a canceled probe neither opens nor closes the circuit
+		b.probing = false
+		return
+	}
+	if !isConnError(err) {
+		if b.state != breakerClosed {
+			log.Info("kv: circuit breaker closed")
+		}
+		b.state = breakerClosed
+		b.failures = 0
+		b.probing = false
+		return
+	}
+
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.opts.failureThreshold {
+		if b.state != breakerOpen {
+			log.Error("kv: circuit breaker opened", log.Err(err))
+		}
+		b.state = breakerOpen
+		b.openedAt = time.Now()
+		b.probing = false
+	}
+}
+
+func (b *breaker) isOpen() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.state == breakerOpen
+}
+
+// BeforeProcess implements redis.Hook
+func (b *breaker) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return ctx, b.allow()
+}
+
+// AfterProcess implements redis.Hook
+func (b *breaker) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	b.done(cmd.Err())
+	return nil
+}
+
+// BeforeProcessPipeline implements redis.Hook
+func (b *breaker) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return ctx, b.allow()
+}
+
+// AfterProcessPipeline implements redis.Hook
+func (b *breaker) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	var err error
+	for _, cmd := range cmds {
+		if isConnError(cmd.Err()) || cmd.Err() == ErrCircuitOpen {
+			err = cmd.Err()
+			break
+		}
+		if errors.Is(cmd.Err(), context.Canceled) {
+			err = cmd.Err()
+		}
+	}
+	b.done(err)
+	return nil
+}
+
+// isConnError check if err is a connection level error, redis reply errors and
+// missing keys do not count as failure
+func isConnError(err error) bool {
+	if err == nil || err == redis.Nil || err == ErrCircuitOpen {
+		return false
+	}
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	_, isReply := err.(redis.Error)
+	return !isReply
+}
+
+// StartHealthCheck add a circuit breaker to client and start pinging redis in background
+// until ctx is done, it should be called once
+func (c *Client) StartHealthCheck(ctx context.Context, opts ...HealthOption) {
+	o := healthOptions{
+		interval:         5 * time.Second,
+		timeout:          time.Second,
+		failureThreshold: 5,
+		openTimeout:      10 * time.Second,
+	}
+	for _, opt := range opts {
+		opt.apply(&o)
+	}
+
+	b := &breaker{opts: o}
+	c.lock.Lock()
+	c.breaker = b
+	c.lock.Unlock()
+	c.addHook(b)
+
+	ping := func() {
+		pCtx, cancel := context.WithTimeout(ctx, o.timeout)
+		defer cancel()
+		err := c.conn().Ping(pCtx).Err()
+
+		b.lock.Lock()
+		b.lastPingErr = err
+		b.lock.Unlock()
+	}
+
+	ping()
+	go func() {
+		ticker := time.NewTicker(o.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				ping()
+			}
+		}
+	}()
+}
+
+// Healthy returns true if last health check succeeded and circuit is not open,
+// it's always true when health check is not started
+func (c *Client) Healthy() bool {
+	c.lock.RLock()
+	b := c.breaker
+	c.lock.RUnlock()
+
+	if b == nil {
+		return true
+	}
+	if b.isOpen() {
+		return false
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.lastPingErr == nil
+}
+
+// ReadinessCheck returns ErrUnhealthy when redis is not healthy, it can be registered
+// as a grpcgw readiness check
+func (c *Client) ReadinessCheck(ctx context.Context) error {
+	if !c.Healthy() {
+		return ErrUnhealthy
+	}
+	return nil
+}
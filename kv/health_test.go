@@ -0,0 +1,81 @@
+package kv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthCheck(t *testing.T) {
+	server, err := miniredis.Run()
+	assert.Nil(t, err)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client, err := InitWithConn(ctx, redis.NewClient(&redis.Options{
+		Addr:       server.Addr(),
+		MaxRetries: -1,
+	}))
+	assert.Nil(t, err)
+	assert.True(t, client.Healthy())
+
+	client.StartHealthCheck(ctx,
+		CheckInterval(10*time.Millisecond),
+		FailureThreshold(2),
+		OpenTimeout(50*time.Millisecond),
+	)
+	assert.True(t, client.Healthy())
+	assert.Nil(t, client.ReadinessCheck(ctx))
+
+	// reply errors should not open the circuit
+	for i := 0; i < 3; i++ {
+		_, err = client.GetString("missing")
+		assert.Equal(t, redis.Nil, err)
+	}
+	assert.True(t, client.Healthy())
+
+	server.Close()
+	assert.Eventually(t, func() bool {
+		return client.Set("k", "v", time.Minute) == ErrCircuitOpen
+	}, time.Second, 5*time.Millisecond)
+	assert.False(t, client.Healthy())
+	assert.Equal(t, ErrUnhealthy, client.ReadinessCheck(ctx))
+
+	assert.Nil(t, server.Restart())
+	assert.Eventually(t, client.Healthy, time.Second, 10*time.Millisecond)
+	assert.Nil(t, client.Set("k", "v", time.Minute))
+}
+
+func TestBreakerCanceled(t *testing.T) {
+	b := &breaker{opts: healthOptions{failureThreshold: 2, openTimeout: time.Millisecond}}
+	b.done(errors.New("dial tcp: connection refused"))
+	b.done(context.Canceled)
+	assert.Equal(t, 1, b.failures)
+	assert.Equal(t, breakerClosed, b.state)
+
+	b.done(errors.New("dial tcp: connection refused"))
+	assert.Equal(t, breakerOpen, b.state)
+
+	// a canceled half-open probe does not close the circuit
+	time.Sleep(2 * time.Millisecond)
+	assert.Nil(t, b.allow())
+	assert.Equal(t, breakerHalfOpen, b.state)
+	b.done(fmt.Errorf("probe: %w", context.Canceled))
+	assert.Equal(t, breakerHalfOpen, b.state)
+	assert.Equal(t, 2, b.failures)
+	assert.False(t, b.probing)
+
+	// and next probe is allowed
+	assert.Nil(t, b.allow())
+	b.done(nil)
+	assert.Equal(t, breakerClosed, b.state)
+	assert.Equal(t, 0, b.failures)
+}
@@ -1,16 +1,133 @@
 package kv
 
-import "sync"
+import (
+	"container/heap"
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
 
 var (
 	inMemory *InMemory
 	doOnce   sync.Once
 )
 
+// EvictionPolicy decide which entry will be evicted when in memory store is full
+type EvictionPolicy int
+
+const (
+	// LRU evict least recently used entry
+	LRU EvictionPolicy = iota
+	// LFU evict least frequently used entry
+	LFU
+)
+
+type memoryOptions struct {
+	maxEntries      int
+	maxBytes        int64
+	policy          EvictionPolicy
+	defaultTTL      time.Duration
+	janitorInterval time.Duration
+}
+
+// A MemoryOption sets options such as size limits, eviction policy and ttl of in memory store
+type MemoryOption interface {
+	apply(*memoryOptions)
+}
+
+// funcMemoryOption wraps a function that modifies memoryOptions into an
+// implementation of the MemoryOption interface.
+type funcMemoryOption struct {
+	f func(*memoryOptions)
+}
+
+func (fmo *funcMemoryOption) apply(mo *memoryOptions) {
+	fmo.f(mo)
+}
+
+func newFuncMemoryOption(f func(*memoryOptions)) *funcMemoryOption {
+	return &funcMemoryOption{
+		f: f,
+	}
+}
+
+// MaxEntries returns a MemoryOption that limit number of entries, zero means unlimited
+func MaxEntries(n int) MemoryOption {
+	return newFuncMemoryOption(func(o *memoryOptions) {
+		o.maxEntries = n
+	})
+}
+
+// MaxBytes returns a MemoryOption that limit total size of keys and values, zero means unlimited
+func MaxBytes(n int64) MemoryOption {
+	return newFuncMemoryOption(func(o *memoryOptions) {
+		o.maxBytes = n
+	})
+}
+
+// Eviction returns a MemoryOption that set eviction policy, default is LRU
+func Eviction(p EvictionPolicy) MemoryOption {
+	return newFuncMemoryOption(func(o *memoryOptions) {
+		o.policy = p
+	})
+}
+
+// DefaultTTL returns a MemoryOption that set ttl of entries stored using SetString
+func DefaultTTL(d time.Duration) MemoryOption {
+	return newFuncMemoryOption(func(o *memoryOptions) {
+		o.defaultTTL = d
+	})
+}
+
+// JanitorInterval returns a MemoryOption that set how often expired entries are removed
+// in background, zero disables the janitor and expired entries are only removed on access
+func JanitorInterval(d time.Duration) MemoryOption {
+	return newFuncMemoryOption(func(o *memoryOptions) {
+		o.janitorInterval = d
+	})
+}
+
+// MemoryStats in memory store statistics
+type MemoryStats struct {
+	Hits        uint64
+	Misses      uint64
+	Evictions   uint64
+	Expirations uint64
+	Entries     int
+	Bytes       int64
+}
+
+type memoryEntry struct {
+	key       string
+	value     string
+	expiresAt time.Time
+
+	// lru
+	elem *list.Element
+
+	// lfu
+	freq  uint64
+	seq   uint64
+	index int
+}
+
+func (e *memoryEntry) size() int64 {
+	return int64(len(e.key) + len(e.value))
+}
+
+func (e *memoryEntry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && now.After(e.expiresAt)
+}
+
 // InMemory in memory kv service
 type InMemory struct {
-	data map[string]string
-	lock sync.RWMutex
+	opts    memoryOptions
+	data    map[string]*memoryEntry
+	evictor evictor
+	bytes   int64
+	stats   MemoryStats
+	lock    sync.Mutex
 }
 
 // Memory retun in memory kv instance
@@ -18,26 +135,295 @@ func Memory() *InMemory {
 	return inMemory
 }
 
-// SetString set a key value
+// NewInMemory create a new in memory kv store, background janitor will stop when ctx is done
+func NewInMemory(ctx context.Context, opts ...MemoryOption) *InMemory {
+	o := memoryOptions{
+		janitorInterval: time.Minute,
+	}
+	for _, opt := range opts {
+		opt.apply(&o)
+	}
+
+	i := newInMemory(o)
+	if o.janitorInterval > 0 {
+		go i.janitor(ctx, o.janitorInterval)
+	}
+	return i
+}
+
+func newInMemory(o memoryOptions) *InMemory {
+	i := &InMemory{
+		opts: o,
+		data: make(map[string]*memoryEntry),
+	}
+	switch o.policy {
+	case LFU:
+		i.evictor = &lfuEvictor{}
+	default:
+		i.evictor = &lruEvictor{list: list.New()}
+	}
+	return i
+}
+
+func (i *InMemory) janitor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			i.DeleteExpired()
+		}
+	}
+}
+
+// SetString set a key value, it will expire after default ttl if it's set
 func (i *InMemory) SetString(key, value string) {
+	i.SetWithTTL(key, value, i.opts.defaultTTL)
+}
+
+// SetWithTTL set a key value that will expire after ttl, zero ttl means never
+// entries bigger than max bytes limit are not stored
+func (i *InMemory) SetWithTTL(key, value string, ttl time.Duration) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	i.set(key, value, ttl)
+}
+
+// SetNX set a key value only if key does not exist and returns true if it was set
+func (i *InMemory) SetNX(key, value string, ttl time.Duration) bool {
 	i.lock.Lock()
 	defer i.lock.Unlock()
 
-	i.data[key] = value
+	if e, ok := i.data[key]; ok && !e.expired(time.Now()) {
+		return false
+	}
+	i.set(key, value, ttl)
+	return true
+}
+
+func (i *InMemory) set(key, value string, ttl time.Duration) {
+	e := &memoryEntry{key: key, value: value}
+	if ttl > 0 {
+		e.expiresAt = time.Now().Add(ttl)
+	}
+	// oversized values are rejected before existing entry is touched
+	if i.opts.maxBytes > 0 && e.size() > i.opts.maxBytes {
+		return
+	}
+
+	if old, ok := i.data[key]; ok {
+		i.remove(old)
+	}
+
+	for i.full(e.size()) {
+		victim := i.evictor.victim()
+		if victim == nil {
+			break
+		}
+		i.remove(victim)
+		i.stats.Evictions++
+	}
+
+	i.data[key] = e
+	i.bytes += e.size()
+	i.evictor.add(e)
 }
 
 // Get get a key value
 func (i *InMemory) Get(key string) (string, bool) {
-	i.lock.RLock()
-	defer i.lock.RUnlock()
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	e, ok := i.data[key]
+	if ok && e.expired(time.Now()) {
+		i.remove(e)
+		i.stats.Expirations++
+		ok = false
+	}
+	if !ok {
+		i.stats.Misses++
+		return "", false
+	}
+
+	i.stats.Hits++
+	i.evictor.touch(e)
+	return e.value, true
+}
+
+// Delete remove a key and returns true if it was exist
+func (i *InMemory) Delete(key string) bool {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	e, ok := i.data[key]
+	if !ok {
+		return false
+	}
+	i.remove(e)
+	return !e.expired(time.Now())
+}
+
+// Keys returns all not expired keys
+func (i *InMemory) Keys() []string {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	now := time.Now()
+	keys := make([]string, 0, len(i.data))
+	for k, e := range i.data {
+		if !e.expired(now) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// Len returns number of stored entries, it may include expired entries not removed yet
+func (i *InMemory) Len() int {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	return len(i.data)
+}
+
+// DeleteExpired remove all expired entries and returns number of removed entries
+func (i *InMemory) DeleteExpired() int {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	now := time.Now()
+	n := 0
+	for _, e := range i.data {
+		if e.expired(now) {
+			i.remove(e)
+			i.stats.Expirations++
+			n++
+		}
+	}
+	return n
+}
+
+// Stats returns in memory store statistics
+func (i *InMemory) Stats() MemoryStats {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	s := i.stats
+	s.Entries = len(i.data)
+	s.Bytes = i.bytes
+	return s
+}
+
+// full check if adding an entry with given size will pass limits
+func (i *InMemory) full(size int64) bool {
+	if i.opts.maxEntries > 0 && len(i.data)+1 > i.opts.maxEntries {
+		return true
+	}
+	return i.opts.maxBytes > 0 && i.bytes+size > i.opts.maxBytes
+}
+
+func (i *InMemory) remove(e *memoryEntry) {
+	delete(i.data, e.key)
+	i.bytes -= e.size()
+	i.evictor.remove(e)
+}
+
+// evictor keep entries in eviction order
+type evictor interface {
+	add(e *memoryEntry)
+	touch(e *memoryEntry)
+	remove(e *memoryEntry)
+	victim() *memoryEntry
+}
+
+type lruEvictor struct {
+	list *list.List
+}
+
+func (l *lruEvictor) add(e *memoryEntry) {
+	e.elem = l.list.PushFront(e)
+}
+
+func (l *lruEvictor) touch(e *memoryEntry) {
+	l.list.MoveToFront(e.elem)
+}
+
+func (l *lruEvictor) remove(e *memoryEntry) {
+	l.list.Remove(e.elem)
+}
+
+func (l *lruEvictor) victim() *memoryEntry {
+	back := l.list.Back()
+	if back == nil {
+		return nil
+	}
+	return back.Value.(*memoryEntry)
+}
+
+// lfuEvictor is a min heap of entries by use frequency, ties are broken by last use
+type lfuEvictor struct {
+	entries []*memoryEntry
+	seq     uint64
+}
+
+func (l *lfuEvictor) Len() int { return len(l.entries) }
+
+func (l *lfuEvictor) Less(a, b int) bool {
+	if l.entries[a].freq == l.entries[b].freq {
+		return l.entries[a].seq < l.entries[b].seq
+	}
+	return l.entries[a].freq < l.entries[b].freq
+}
+
+func (l *lfuEvictor) Swap(a, b int) {
+	l.entries[a], l.entries[b] = l.entries[b], l.entries[a]
+	l.entries[a].index = a
+	l.entries[b].index = b
+}
+
+func (l *lfuEvictor) Push(x interface{}) {
+	e := x.(*memoryEntry)
+	e.index = len(l.entries)
+	l.entries = append(l.entries, e)
+}
+
+func (l *lfuEvictor) Pop() interface{} {
+	n := len(l.entries)
+	e := l.entries[n-1]
+	l.entries[n-1] = nil
+	l.entries = l.entries[:n-1]
+	return e
+}
+
+func (l *lfuEvictor) add(e *memoryEntry) {
+	l.seq++
+	e.freq = 1
+	e.seq = l.seq
+	heap.Push(l, e)
+}
+
+func (l *lfuEvictor) touch(e *memoryEntry) {
+	l.seq++
+	e.freq++
+	e.seq = l.seq
+	heap.Fix(l, e.index)
+}
+
+func (l *lfuEvictor) remove(e *memoryEntry) {
+	heap.Remove(l, e.index)
+}
 
-	r, ok := i.data[key]
-	return r, ok
+func (l *lfuEvictor) victim() *memoryEntry {
+	if len(l.entries) == 0 {
+		return nil
+	}
+	return l.entries[0]
 }
 
 func init() {
 	doOnce.Do(func() {
-		inMemory = new(InMemory)
-		inMemory.data = make(map[string]string)
+		inMemory = newInMemory(memoryOptions{})
 	})
 }
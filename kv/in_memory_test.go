@@ -1,7 +1,9 @@
 package kv
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -18,3 +20,88 @@ func TestInMemory(t *testing.T) {
 	assert.False(t, ok)
 	assert.Empty(t, s)
 }
+
+func TestInMemoryTTL(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	i := NewInMemory(ctx, JanitorInterval(10*time.Millisecond))
+	i.SetWithTTL("short", "v", 20*time.Millisecond)
+	i.SetString("forever", "v")
+
+	s, ok := i.Get("short")
+	assert.True(t, ok)
+	assert.Equal(t, "v", s)
+	assert.Equal(t, 2, i.Len())
+
+	assert.Eventually(t, func() bool { return i.Len() == 1 }, time.Second, 10*time.Millisecond)
+	_, ok = i.Get("short")
+	assert.False(t, ok)
+	assert.Equal(t, []string{"forever"}, i.Keys())
+	assert.Equal(t, uint64(1), i.Stats().Expirations)
+
+	assert.True(t, i.Delete("forever"))
+	assert.False(t, i.Delete("forever"))
+	assert.Equal(t, 0, i.Len())
+}
+
+func TestInMemoryLRU(t *testing.T) {
+	i := NewInMemory(context.Background(), MaxEntries(2), JanitorInterval(0))
+	i.SetString("a", "1")
+	i.SetString("b", "2")
+	i.Get("a")
+	i.SetString("c", "3")
+
+	_, ok := i.Get("b")
+	assert.False(t, ok)
+	_, ok = i.Get("a")
+	assert.True(t, ok)
+	_, ok = i.Get("c")
+	assert.True(t, ok)
+
+	stats := i.Stats()
+	assert.Equal(t, uint64(1), stats.Evictions)
+	assert.Equal(t, uint64(3), stats.Hits)
+	assert.Equal(t, uint64(1), stats.Misses)
+	assert.Equal(t, 2, stats.Entries)
+	assert.Equal(t, int64(4), stats.Bytes)
+}
+
+func TestInMemoryLFU(t *testing.T) {
+	i := NewInMemory(context.Background(), MaxEntries(2), Eviction(LFU), JanitorInterval(0))
+	i.SetString("a", "1")
+	i.SetString("b", "2")
+	i.Get("a")
+	i.Get("a")
+	i.Get("b")
+	i.SetString("c", "3")
+
+	_, ok := i.Get("b")
+	assert.False(t, ok)
+	_, ok = i.Get("a")
+	assert.True(t, ok)
+}
+
+func TestInMemoryMaxBytes(t *testing.T) {
+	i := NewInMemory(context.Background(), MaxBytes(10), JanitorInterval(0))
+	i.SetString("a", "1234")
+	i.SetString("b", "1234")
+	assert.Equal(t, 2, i.Len())
+
+	i.SetString("c", "1234")
+	assert.Equal(t, 2, i.Len())
+	_, ok := i.Get("a")
+	assert.False(t, ok)
+
+	// bigger than limit
+	i.SetString("d", "12345678901")
+	_, ok = i.Get("d")
+	assert.False(t, ok)
+	assert.LessOrEqual(t, i.Stats().Bytes, int64(10))
+
+	// too big value does not replace existing one
+	i.SetWithTTL("c", "12345678901", time.Minute)
+	v, ok := i.Get("c")
+	assert.True(t, ok)
+	assert.Equal(t, "1234", v)
+}
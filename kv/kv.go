@@ -2,7 +2,11 @@ package kv
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -11,6 +15,9 @@ import (
 
 var (
 	client *Client
+
+	// ErrNotFound is returned when a key does not exist
+	ErrNotFound = errors.New("kv: key not found")
 )
 
 // Config kv redis config
@@ -19,18 +26,96 @@ type Config struct {
 	Port     int
 	Password string
 	DB       int
+
+	// PoolSize and MinIdleConns tune the connection pool, zero values
+	// will use go-redis defaults
+	PoolSize     int
+	MinIdleConns int
+
+	DialTimeout  time.Duration
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+
+	// TLS enable tls connection to redis server
+	TLS                   bool
+	TLSInsecureSkipVerify bool
+	TLSServerName         string
+
+	// Namespace will prefix all keys transparently, e.g. "users" will store "id" as "users:id"
+	Namespace string
 }
 
 // Client kv client service
 type Client struct {
-	ctx    context.Context
-	client *redis.Client
+	ctx       context.Context
+	lock      sync.RWMutex
+	client    *redis.Client
+	namespace string
+	hooks     []redis.Hook
+	codec     Codec
+	breaker   *breaker
 }
 
 // With returns a Client with context
 func (c *Client) With(ctx context.Context) *redis.Client {
 	c.ctx = ctx
-	return c.client.WithContext(ctx)
+	return c.conn().WithContext(ctx)
+}
+
+// Redis returns current redis client without changing default context of Client like With,
+// so it's safe to use in libraries, each command should be given its own context. Keys are not
+// namespaced so Key should be used to build them, hooks of metrics and health check still apply.
+// Client is replaced on reconnect so it should be called for each use instead of being kept
+func (c *Client) Redis() *redis.Client {
+	return c.conn()
+}
+
+// conn return current redis client, it may be replaced on reconnect
+func (c *Client) conn() *redis.Client {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.client
+}
+
+// SetNamespace set client keys namespace, it should be called before client is in use
+func (c *Client) SetNamespace(ns string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.namespace = ns
+}
+
+// Namespace returns client keys namespace
+func (c *Client) Namespace() string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.namespace
+}
+
+// Key returns the actual redis key of given key with namespace prefix
+func (c *Client) Key(key string) string {
+	ns := c.Namespace()
+	if ns == "" {
+		return key
+	}
+	return ns + ":" + key
+}
+
+// keys returns Key of each given key
+func (c *Client) keys(keys []string) []string {
+	res := make([]string, len(keys))
+	for i := range keys {
+		res[i] = c.Key(keys[i])
+	}
+	return res
+}
+
+// stripKey remove namespace prefix from a redis key
+func (c *Client) stripKey(key string) string {
+	ns := c.Namespace()
+	if ns == "" {
+		return key
+	}
+	return strings.TrimPrefix(key, ns+":")
 }
 
 // Get will return redis connection
@@ -40,12 +125,12 @@ func Get() *Client {
 
 // Conn will return redis connection
 func (c *Client) Conn() *redis.Conn {
-	return c.client.Conn(c.ctx)
+	return c.conn().Conn(c.ctx)
 }
 
 // Set will set a key ( string ) to a value ( interface )
 func (c *Client) Set(key string, val interface{}, alive time.Duration) error {
-	err := c.client.Set(c.ctx, key, val, alive).Err()
+	err := c.conn().Set(c.ctx, c.Key(key), val, alive).Err()
 	if err != nil {
 		log.Error("kv: write error", log.Err(err))
 	}
@@ -54,7 +139,7 @@ func (c *Client) Set(key string, val interface{}, alive time.Duration) error {
 
 // GetString will read and return a key as string
 func (c *Client) GetString(key string) (string, error) {
-	val, err := c.client.Get(c.ctx, key).Result()
+	val, err := c.conn().Get(c.ctx, c.Key(key)).Result()
 	if err != nil {
 		return "", err
 	}
@@ -63,7 +148,7 @@ func (c *Client) GetString(key string) (string, error) {
 
 // Delete will remove a key
 func (c *Client) Delete(key string) error {
-	err := c.client.Del(c.ctx, key).Err()
+	err := c.conn().Del(c.ctx, c.Key(key)).Err()
 	if err != nil {
 		log.Error("kv: delete key error", log.Err(err))
 		return err
@@ -71,6 +156,58 @@ func (c *Client) Delete(key string) error {
 	return nil
 }
 
+// reconnect replace the underlying redis client with a new one built from config
+// the old connection will close after the new one is ready
+func (c *Client) reconnect(ctx context.Context, config *Config) error {
+	rdb := newRedisClient(config)
+	if _, err := rdb.Ping(ctx).Result(); err != nil {
+		_ = rdb.Close()
+		return err
+	}
+
+	c.lock.Lock()
+	for _, h := range c.hooks {
+		rdb.AddHook(h)
+	}
+	old := c.client
+	c.client = rdb
+	c.namespace = config.Namespace
+	c.lock.Unlock()
+
+	return old.Close()
+}
+
+func newRedisClient(config *Config) *redis.Client {
+	opts := &redis.Options{
+		Addr:         fmt.Sprintf("%s:%d", config.Host, config.Port),
+		Password:     config.Password,
+		DB:           config.DB,
+		PoolSize:     config.PoolSize,
+		MinIdleConns: config.MinIdleConns,
+		DialTimeout:  config.DialTimeout,
+		ReadTimeout:  config.ReadTimeout,
+		WriteTimeout: config.WriteTimeout,
+	}
+	if config.TLS {
+		opts.TLSConfig = &tls.Config{
+			ServerName:         config.TLSServerName,
+			InsecureSkipVerify: config.TLSInsecureSkipVerify, // nolint:gosec
+		}
+	}
+	return redis.NewClient(opts)
+}
+
+func newClient(ctx context.Context, rdb *redis.Client) *Client {
+	c := &Client{ctx: ctx, client: rdb}
+	go func() {
+		<-ctx.Done()
+		if err := c.conn().Close(); err != nil {
+			log.Error("error in close redis connection", log.Err(err))
+		}
+	}()
+	return c
+}
+
 // Init will initialize the key value store
 func Init(ctx context.Context, config *Config) (*Client, error) {
 
@@ -84,11 +221,7 @@ func Init(ctx context.Context, config *Config) (*Client, error) {
 		}
 	}
 
-	rdb := redis.NewClient(&redis.Options{
-		Addr:     fmt.Sprintf("%s:%d", config.Host, config.Port),
-		Password: config.Password,
-		DB:       config.DB,
-	})
+	rdb := newRedisClient(config)
 
 	_, err := rdb.Ping(ctx).Result()
 	if err != nil {
@@ -96,14 +229,8 @@ func Init(ctx context.Context, config *Config) (*Client, error) {
 		return nil, err
 	}
 
-	go func() {
-		<-ctx.Done()
-		if err := rdb.Close(); err != nil {
-			log.Error("error in close redis connection", log.Err(err))
-		}
-	}()
-
-	client = &Client{ctx: ctx, client: rdb}
+	client = newClient(ctx, rdb)
+	client.namespace = config.Namespace
 	return client, nil
 }
 
@@ -116,13 +243,6 @@ func InitWithConn(ctx context.Context, redisClient *redis.Client) (*Client, erro
 		return nil, err
 	}
 
-	go func() {
-		<-ctx.Done()
-		if err := redisClient.Close(); err != nil {
-			log.Error("error in close redis connection", log.Err(err))
-		}
-	}()
-
-	client = &Client{ctx: ctx, client: redisClient}
+	client = newClient(ctx, redisClient)
 	return client, nil
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"github.com/alicebob/miniredis/v2"
 	"github.com/go-redis/redis/v8"
+	"github.com/golang-tire/pkg/log"
 	"github.com/stretchr/testify/assert"
 	"os"
 	"strconv"
@@ -19,6 +20,10 @@ var testConfig *Config = &Config{
 }
 
 func TestMain(m *testing.M) {
+	if err := log.Init(context.Background(), true); err != nil {
+		panic(err)
+	}
+
 	var err error
 	redisServer, err = miniredis.Run()
 	if err != nil {
@@ -79,6 +84,52 @@ func TestWith(t *testing.T) {
 	assert.Equal(t, v, "test-value")
 }
 
+// countHook count processed commands
+type countHook struct {
+	n int
+}
+
+func (h *countHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	h.n++
+	return ctx, nil
+}
+
+func (h *countHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	return nil
+}
+
+func (h *countHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	h.n += len(cmds)
+	return ctx, nil
+}
+
+func (h *countHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	return nil
+}
+
+func TestRedis(t *testing.T) {
+	ctx := context.Background()
+	c := newClient(ctx, newRedisClient(testConfig))
+	c.SetNamespace("raw")
+	hook := &countHook{}
+	c.addHook(hook)
+
+	// context of command is not kept by client
+	cmdCtx, cancel := context.WithCancel(ctx)
+	assert.Nil(t, c.Redis().Set(cmdCtx, c.Key("redis"), "v", time.Minute).Err())
+	cancel()
+	v, err := c.GetString("redis")
+	assert.Nil(t, err)
+	assert.Equal(t, "v", v)
+
+	// keys are not namespaced and hooks apply
+	assert.Nil(t, c.Redis().Set(ctx, "redis", "plain", time.Minute).Err())
+	v, err = c.GetString("redis")
+	assert.Nil(t, err)
+	assert.Equal(t, "v", v)
+	assert.Equal(t, 4, hook.n)
+}
+
 func TestSet(t *testing.T) {
 	ctx := context.Background()
 	client, err := Init(ctx, testConfig)
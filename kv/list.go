@@ -0,0 +1,81 @@
+package kv
+
+import (
+	"context"
+	"time"
+)
+
+// List is a wrapper of redis list that can be used as a queue, values are encoded using client codec
+type List struct {
+	structure
+}
+
+// List returns a wrapper of redis list stored at key
+func (c *Client) List(key string) *List {
+	return &List{structure: newStructure(c, key)}
+}
+
+// Push append values to the tail of list
+func (l *List) Push(ctx context.Context, values ...interface{}) error {
+	v, err := l.client.encodeAll(values)
+	if err != nil {
+		return err
+	}
+	return l.client.conn().RPush(ctx, l.key, v...).Err()
+}
+
+// PushFront insert values at the head of list
+func (l *List) PushFront(ctx context.Context, values ...interface{}) error {
+	v, err := l.client.encodeAll(values)
+	if err != nil {
+		return err
+	}
+	return l.client.conn().LPush(ctx, l.key, v...).Err()
+}
+
+// Pop remove the head of list and decode it into out, it returns ErrNotFound if list is empty
+func (l *List) Pop(ctx context.Context, out interface{}) error {
+	v, err := l.client.conn().LPop(ctx, l.key).Result()
+	if err != nil {
+		return notFound(err)
+	}
+	return l.client.decode(v, out)
+}
+
+// PopBack remove the tail of list and decode it into out, it returns ErrNotFound if list is empty
+func (l *List) PopBack(ctx context.Context, out interface{}) error {
+	v, err := l.client.conn().RPop(ctx, l.key).Result()
+	if err != nil {
+		return notFound(err)
+	}
+	return l.client.decode(v, out)
+}
+
+// BPop wait up to timeout for a value at the head of list, it returns ErrNotFound on timeout
+func (l *List) BPop(ctx context.Context, timeout time.Duration, out interface{}) error {
+	v, err := l.client.conn().BLPop(ctx, timeout, l.key).Result()
+	if err != nil {
+		return notFound(err)
+	}
+	// first item is the key name
+	return l.client.decode(v[1], out)
+}
+
+// Range decode values between start and stop indexes into out which should be a pointer to slice
+func (l *List) Range(ctx context.Context, start, stop int64, out interface{}) error {
+	v, err := l.client.conn().LRange(ctx, l.key, start, stop).Result()
+	if err != nil {
+		return err
+	}
+	return l.client.decodeSlice(v, out)
+}
+
+// Len returns length of list
+func (l *List) Len(ctx context.Context) (int64, error) {
+	return l.client.conn().LLen(ctx, l.key).Result()
+}
+
+// Trim keep only values between start and stop indexes
+func (l *List) Trim(ctx context.Context, start, stop int64) error {
+	return l.client.conn().LTrim(ctx, l.key, start, stop).Err()
+}
@@ -0,0 +1,50 @@
+package kv
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestList(t *testing.T) {
+	ctx := context.Background()
+	client, err := Init(ctx, testConfig)
+	assert.Nil(t, err)
+
+	type job struct {
+		ID int
+	}
+
+	// key is unique per run since miniredis is shared by tests
+	q := client.List("jobs:" + uuid.New().String())
+	assert.Nil(t, q.Push(ctx, job{ID: 1}, job{ID: 2}))
+	assert.Nil(t, q.PushFront(ctx, job{ID: 0}))
+
+	n, err := q.Len(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), n)
+
+	var jobs []job
+	assert.Nil(t, q.Range(ctx, 0, -1, &jobs))
+	assert.Equal(t, []job{{ID: 0}, {ID: 1}, {ID: 2}}, jobs)
+
+	var j job
+	assert.Nil(t, q.Pop(ctx, &j))
+	assert.Equal(t, 0, j.ID)
+	assert.Nil(t, q.PopBack(ctx, &j))
+	assert.Equal(t, 2, j.ID)
+	assert.Nil(t, q.BPop(ctx, time.Second, &j))
+	assert.Equal(t, 1, j.ID)
+
+	assert.Equal(t, ErrNotFound, q.Pop(ctx, &j))
+
+	assert.Nil(t, q.Push(ctx, "a", "b", "c"))
+	assert.Nil(t, q.Trim(ctx, 1, -1))
+	var s []string
+	assert.Nil(t, q.Range(ctx, 0, -1, &s))
+	assert.Equal(t, []string{"b", "c"}, s)
+	assert.NotNil(t, q.Range(ctx, 0, -1, s))
+}
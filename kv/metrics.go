@@ -0,0 +1,260 @@
+package kv
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Tracer start spans around kv operations, it can be backed by OpenTelemetry
+// or any other tracing library
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a single traced kv operation
+type Span interface {
+	SetAttribute(key string, value interface{})
+	RecordError(err error)
+	End()
+}
+
+type instrumentOptions struct {
+	registerer prometheus.Registerer
+	tracer     Tracer
+	buckets    []float64
+}
+
+// A InstrumentOption sets options such as metrics registry and tracer
+type InstrumentOption interface {
+	apply(*instrumentOptions)
+}
+
+// funcInstrumentOption wraps a function that modifies instrumentOptions into an
+// implementation of the InstrumentOption interface.
+type funcInstrumentOption struct {
+	f func(*instrumentOptions)
+}
+
+func (fio *funcInstrumentOption) apply(io *instrumentOptions) {
+	fio.f(io)
+}
+
+func newFuncInstrumentOption(f func(*instrumentOptions)) *funcInstrumentOption {
+	return &funcInstrumentOption{
+		f: f,
+	}
+}
+
+// WithRegisterer returns a InstrumentOption that register metrics in given registerer
+// instead of prometheus.DefaultRegisterer
+func WithRegisterer(r prometheus.Registerer) InstrumentOption {
+	return newFuncInstrumentOption(func(o *instrumentOptions) {
+		o.registerer = r
+	})
+}
+
+// WithTracer returns a InstrumentOption that start a span for every command
+func WithTracer(t Tracer) InstrumentOption {
+	return newFuncInstrumentOption(func(o *instrumentOptions) {
+		o.tracer = t
+	})
+}
+
+// WithBuckets returns a InstrumentOption that set latency histogram buckets
+func WithBuckets(b []float64) InstrumentOption {
+	return newFuncInstrumentOption(func(o *instrumentOptions) {
+		o.buckets = b
+	})
+}
+
+type metrics struct {
+	duration *prometheus.HistogramVec
+	errors   *prometheus.CounterVec
+	hits     *prometheus.CounterVec
+	misses   *prometheus.CounterVec
+}
+
+// Instrument register metrics for client and add hooks that record latency, errors,
+// get hits/misses and connection pool stats of every command, and start a span
+// for every command if a tracer is given
+func (c *Client) Instrument(opts ...InstrumentOption) error {
+	o := instrumentOptions{
+		registerer: prometheus.DefaultRegisterer,
+		buckets:    prometheus.DefBuckets,
+	}
+	for _, opt := range opts {
+		opt.apply(&o)
+	}
+
+	m := &metrics{
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "kv",
+			Name:      "command_duration_seconds",
+			Help:      "Latency of redis commands.",
+			Buckets:   o.buckets,
+		}, []string{"command"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "kv",
+			Name:      "command_errors_total",
+			Help:      "Number of failed redis commands.",
+		}, []string{"command"}),
+		hits: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "kv",
+			Name:      "get_hits_total",
+			Help:      "Number of keys found by get commands.",
+		}, []string{"command"}),
+		misses: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "kv",
+			Name:      "get_misses_total",
+			Help:      "Number of keys not found by get commands.",
+		}, []string{"command"}),
+	}
+
+	for _, col := range []prometheus.Collector{m.duration, m.errors, m.hits, m.misses, &poolCollector{client: c}} {
+		if err := o.registerer.Register(col); err != nil {
+			return err
+		}
+	}
+
+	c.addHook(&instrumentHook{metrics: m, tracer: o.tracer})
+	return nil
+}
+
+// addHook add a hook to current redis client and keep it to add again on reconnect
+func (c *Client) addHook(h redis.Hook) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.hooks = append(c.hooks, h)
+	c.client.AddHook(h)
+}
+
+type startKey struct{}
+
+type spanKey struct{}
+
+type instrumentHook struct {
+	metrics *metrics
+	tracer  Tracer
+}
+
+func (h *instrumentHook) before(ctx context.Context, name string) context.Context {
+	if h.tracer != nil {
+		var span Span
+		ctx, span = h.tracer.Start(ctx, "kv."+name)
+		ctx = context.WithValue(ctx, spanKey{}, span)
+	}
+	return context.WithValue(ctx, startKey{}, time.Now())
+}
+
+func (h *instrumentHook) after(ctx context.Context, name string, err error) {
+	if start, ok := ctx.Value(startKey{}).(time.Time); ok {
+		h.metrics.duration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+	}
+
+	if span, ok := ctx.Value(spanKey{}).(Span); ok {
+		span.SetAttribute("db.system", "redis")
+		span.SetAttribute("db.operation", name)
+		if err != nil && err != redis.Nil {
+			span.RecordError(err)
+		}
+		span.End()
+	}
+}
+
+func (h *instrumentHook) record(cmd redis.Cmder) {
+	name := cmd.Name()
+	err := cmd.Err()
+	if err != nil && err != redis.Nil {
+		h.metrics.errors.WithLabelValues(name).Inc()
+		return
+	}
+
+	switch name {
+	case "get", "hget":
+		if err == redis.Nil {
+			h.metrics.misses.WithLabelValues(name).Inc()
+		} else {
+			h.metrics.hits.WithLabelValues(name).Inc()
+		}
+	case "mget", "hmget":
+		sc, ok := cmd.(*redis.SliceCmd)
+		if !ok {
+			return
+		}
+		for _, v := range sc.Val() {
+			if v == nil {
+				h.metrics.misses.WithLabelValues(name).Inc()
+			} else {
+				h.metrics.hits.WithLabelValues(name).Inc()
+			}
+		}
+	}
+}
+
+// BeforeProcess implements redis.Hook
+func (h *instrumentHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return h.before(ctx, cmd.Name()), nil
+}
+
+// AfterProcess implements redis.Hook
+func (h *instrumentHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	h.record(cmd)
+	h.after(ctx, cmd.Name(), cmd.Err())
+	return nil
+}
+
+// BeforeProcessPipeline implements redis.Hook
+func (h *instrumentHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return h.before(ctx, "pipeline"), nil
+}
+
+// AfterProcessPipeline implements redis.Hook
+func (h *instrumentHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	var err error
+	for _, cmd := range cmds {
+		h.record(cmd)
+		if err == nil && cmd.Err() != redis.Nil {
+			err = cmd.Err()
+		}
+	}
+	h.after(ctx, "pipeline", err)
+	return nil
+}
+
+// poolCollector export connection pool stats of client
+type poolCollector struct {
+	client *Client
+}
+
+var (
+	poolHitsDesc     = prometheus.NewDesc("kv_pool_hits_total", "Number of times free connection was found in the pool.", nil, nil)
+	poolMissesDesc   = prometheus.NewDesc("kv_pool_misses_total", "Number of times free connection was not found in the pool.", nil, nil)
+	poolTimeoutsDesc = prometheus.NewDesc("kv_pool_timeouts_total", "Number of times a wait timeout occurred.", nil, nil)
+	poolTotalDesc    = prometheus.NewDesc("kv_pool_connections", "Number of total connections in the pool.", nil, nil)
+	poolIdleDesc     = prometheus.NewDesc("kv_pool_idle_connections", "Number of idle connections in the pool.", nil, nil)
+	poolStaleDesc    = prometheus.NewDesc("kv_pool_stale_connections_total", "Number of stale connections removed from the pool.", nil, nil)
+)
+
+// Describe implements prometheus.Collector
+func (pc *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- poolHitsDesc
+	ch <- poolMissesDesc
+	ch <- poolTimeoutsDesc
+	ch <- poolTotalDesc
+	ch <- poolIdleDesc
+	ch <- poolStaleDesc
+}
+
+// Collect implements prometheus.Collector
+func (pc *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := pc.client.conn().PoolStats()
+	ch <- prometheus.MustNewConstMetric(poolHitsDesc, prometheus.CounterValue, float64(stats.Hits))
+	ch <- prometheus.MustNewConstMetric(poolMissesDesc, prometheus.CounterValue, float64(stats.Misses))
+	ch <- prometheus.MustNewConstMetric(poolTimeoutsDesc, prometheus.CounterValue, float64(stats.Timeouts))
+	ch <- prometheus.MustNewConstMetric(poolTotalDesc, prometheus.GaugeValue, float64(stats.TotalConns))
+	ch <- prometheus.MustNewConstMetric(poolIdleDesc, prometheus.GaugeValue, float64(stats.IdleConns))
+	ch <- prometheus.MustNewConstMetric(poolStaleDesc, prometheus.CounterValue, float64(stats.StaleConns))
+}
@@ -0,0 +1,70 @@
+package kv
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+type testSpan struct {
+	tracer *testTracer
+	name   string
+}
+
+func (s *testSpan) SetAttribute(key string, value interface{}) {}
+func (s *testSpan) RecordError(err error)                      {}
+func (s *testSpan) End() {
+	s.tracer.lock.Lock()
+	defer s.tracer.lock.Unlock()
+	s.tracer.ended = append(s.tracer.ended, s.name)
+}
+
+type testTracer struct {
+	lock  sync.Mutex
+	ended []string
+}
+
+func (t *testTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	return ctx, &testSpan{tracer: t, name: name}
+}
+
+func TestInstrument(t *testing.T) {
+	ctx := context.Background()
+	client, err := InitWithConn(ctx, newRedisClient(testConfig))
+	assert.Nil(t, err)
+
+	reg := prometheus.NewRegistry()
+	tracer := &testTracer{}
+	err = client.Instrument(WithRegisterer(reg), WithTracer(tracer))
+	assert.Nil(t, err)
+
+	assert.Nil(t, client.Set("metrics", "v", time.Minute))
+	_, err = client.GetString("metrics")
+	assert.Nil(t, err)
+	_, err = client.GetString("metrics-missing")
+	assert.NotNil(t, err)
+	_, err = client.MGet(ctx, "metrics", "metrics-missing")
+	assert.Nil(t, err)
+	_, err = client.Batch().Get("metrics").Exec(ctx)
+	assert.Nil(t, err)
+
+	m := client.hooks[0].(*instrumentHook).metrics
+	assert.Equal(t, float64(2), testutil.ToFloat64(m.hits.WithLabelValues("get")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.misses.WithLabelValues("get")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.hits.WithLabelValues("mget")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.misses.WithLabelValues("mget")))
+	// set, get, mget and pipeline
+	assert.Equal(t, 4, testutil.CollectAndCount(m.duration))
+	assert.Equal(t, []string{"kv.set", "kv.get", "kv.get", "kv.mget", "kv.pipeline"}, tracer.ended)
+
+	// pool stats
+	assert.Equal(t, 6, testutil.CollectAndCount(&poolCollector{client: client}))
+
+	// registering twice in same registry should fail
+	assert.NotNil(t, client.Instrument(WithRegisterer(reg)))
+}
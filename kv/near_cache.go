@@ -0,0 +1,200 @@
+package kv
+
+import (
+	"context"
+	"time"
+
+	"github.com/golang-tire/pkg/log"
+	"github.com/golang-tire/pkg/pubsub"
+	"github.com/golang/protobuf/proto"
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+type nearCacheOptions struct {
+	localTTL   time.Duration
+	maxEntries int
+	maxBytes   int64
+	topic      string
+}
+
+// A NearCacheOption sets options such as local tier ttl and size of near cache
+type NearCacheOption interface {
+	apply(*nearCacheOptions)
+}
+
+// funcNearCacheOption wraps a function that modifies nearCacheOptions into an
+// implementation of the NearCacheOption interface.
+type funcNearCacheOption struct {
+	f func(*nearCacheOptions)
+}
+
+func (fno *funcNearCacheOption) apply(no *nearCacheOptions) {
+	fno.f(no)
+}
+
+func newFuncNearCacheOption(f func(*nearCacheOptions)) *funcNearCacheOption {
+	return &funcNearCacheOption{
+		f: f,
+	}
+}
+
+// LocalTTL returns a NearCacheOption that set how long a value is kept in local tier
+func LocalTTL(d time.Duration) NearCacheOption {
+	return newFuncNearCacheOption(func(o *nearCacheOptions) {
+		o.localTTL = d
+	})
+}
+
+// LocalMaxEntries returns a NearCacheOption that limit number of local tier entries
+func LocalMaxEntries(n int) NearCacheOption {
+	return newFuncNearCacheOption(func(o *nearCacheOptions) {
+		o.maxEntries = n
+	})
+}
+
+// LocalMaxBytes returns a NearCacheOption that limit size of local tier
+func LocalMaxBytes(n int64) NearCacheOption {
+	return newFuncNearCacheOption(func(o *nearCacheOptions) {
+		o.maxBytes = n
+	})
+}
+
+// InvalidationTopic returns a NearCacheOption that set pubsub topic used to broadcast invalidations
+func InvalidationTopic(topic string) NearCacheOption {
+	return newFuncNearCacheOption(func(o *nearCacheOptions) {
+		o.topic = topic
+	})
+}
+
+// NearCache is a two tier cache that keep hot keys in a local in memory tier in front of redis,
+// writes go through to redis and invalidations are broadcast to other replicas using pubsub
+type NearCache struct {
+	id       string
+	local    *InMemory
+	localTTL time.Duration
+	remote   *Client
+	ps       pubsub.Service
+	topic    string
+}
+
+// NewNearCache create a near cache in front of remote client, invalidations are published using ps
+// and if ps is nil invalidations will only apply to local tier. It returns an error if invalidations
+// can not be subscribed
+func NewNearCache(ctx context.Context, remote *Client, ps pubsub.Service, opts ...NearCacheOption) (*NearCache, error) {
+	o := nearCacheOptions{
+		localTTL:   time.Minute,
+		maxEntries: 10000,
+		topic:      "kv.invalidate",
+	}
+	for _, opt := range opts {
+		opt.apply(&o)
+	}
+
+	n := &NearCache{
+		id: uuid.New().String(),
+		local: NewInMemory(ctx,
+			DefaultTTL(o.localTTL),
+			MaxEntries(o.maxEntries),
+			MaxBytes(o.maxBytes),
+			JanitorInterval(o.localTTL),
+		),
+		localTTL: o.localTTL,
+		remote:   remote,
+		ps:       ps,
+		topic:    o.topic,
+	}
+
+	if ps != nil {
+		_, err := ps.SubscribeFunc(ctx, o.topic, func() proto.Message {
+			return &structpb.Struct{}
+		}, func(ctx context.Context, msg proto.Message) error {
+			return n.handleInvalidation(ctx, msg.(*structpb.Struct))
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return n, nil
+}
+
+// Local returns local tier of near cache
+func (n *NearCache) Local() *InMemory {
+	return n.local
+}
+
+// Get read a key from local tier and fallback to redis, it returns ErrNotFound if key does not exist
+func (n *NearCache) Get(ctx context.Context, key string) (string, error) {
+	k := n.remote.Key(key)
+	if v, ok := n.local.Get(k); ok {
+		return v, nil
+	}
+
+	pipe := n.remote.conn().Pipeline()
+	get := pipe.Get(ctx, k)
+	pttl := pipe.PTTL(ctx, k)
+	_, _ = pipe.Exec(ctx)
+
+	v, err := get.Result()
+	if err != nil {
+		return "", notFound(err)
+	}
+
+	// local copy should not outlive the key in redis
+	ttl := n.localTTL
+	if d, err := pttl.Result(); err == nil && d > 0 && d < ttl {
+		ttl = d
+	}
+	n.local.SetWithTTL(k, v, ttl)
+	return v, nil
+}
+
+// Set write a key to redis and invalidate it in all replicas
+func (n *NearCache) Set(ctx context.Context, key string, val interface{}, alive time.Duration) error {
+	if err := n.remote.conn().Set(ctx, n.remote.Key(key), val, alive).Err(); err != nil {
+		log.Error("kv: write error", log.Err(err))
+		return err
+	}
+	return n.Invalidate(ctx, key)
+}
+
+// Delete remove keys from redis and invalidate them in all replicas
+func (n *NearCache) Delete(ctx context.Context, keys ...string) error {
+	if _, err := n.remote.MDelete(ctx, keys...); err != nil {
+		return err
+	}
+	return n.Invalidate(ctx, keys...)
+}
+
+// Invalidate evict keys from local tier of all replicas
+func (n *NearCache) Invalidate(ctx context.Context, keys ...string) error {
+	list := make([]interface{}, len(keys))
+	for i, key := range keys {
+		k := n.remote.Key(key)
+		n.local.Delete(k)
+		list[i] = k
+	}
+
+	if n.ps == nil || len(keys) == 0 {
+		return nil
+	}
+
+	msg, err := structpb.NewStruct(map[string]interface{}{
+		"origin": n.id,
+		"keys":   list,
+	})
+	if err != nil {
+		return err
+	}
+	return n.ps.Publish(ctx, n.topic, msg)
+}
+
+func (n *NearCache) handleInvalidation(ctx context.Context, msg *structpb.Struct) error {
+	if msg.Fields["origin"].GetStringValue() == n.id {
+		return nil
+	}
+	for _, k := range msg.Fields["keys"].GetListValue().GetValues() {
+		n.local.Delete(k.GetStringValue())
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package kv
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-tire/pkg/pubsub"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNearCache(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client, err := Init(ctx, testConfig)
+	assert.Nil(t, err)
+
+	ps := pubsub.New(newRedisClient(testConfig))
+	a, err := NewNearCache(ctx, client, ps, LocalTTL(time.Minute))
+	assert.Nil(t, err)
+	b, err := NewNearCache(ctx, client, ps, LocalTTL(time.Minute))
+	assert.Nil(t, err)
+
+	_, err = a.Get(ctx, "near")
+	assert.Equal(t, ErrNotFound, err)
+
+	assert.Nil(t, a.Set(ctx, "near", "v1", time.Minute))
+
+	v, err := b.Get(ctx, "near")
+	assert.Nil(t, err)
+	assert.Equal(t, "v1", v)
+	_, ok := b.Local().Get("near")
+	assert.True(t, ok)
+
+	// served from local tier
+	assert.Nil(t, redisServer.Set("near", "changed-behind"))
+	v, err = b.Get(ctx, "near")
+	assert.Nil(t, err)
+	assert.Equal(t, "v1", v)
+
+	assert.Nil(t, a.Set(ctx, "near", "v2", time.Minute))
+	assert.Eventually(t, func() bool {
+		_, ok := b.Local().Get("near")
+		return !ok
+	}, time.Second, 10*time.Millisecond)
+
+	v, err = b.Get(ctx, "near")
+	assert.Nil(t, err)
+	assert.Equal(t, "v2", v)
+
+	assert.Nil(t, a.Delete(ctx, "near"))
+	assert.Eventually(t, func() bool {
+		_, err := b.Get(ctx, "near")
+		return err == ErrNotFound
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestNearCacheWithoutPubSub(t *testing.T) {
+	ctx := context.Background()
+	client, err := Init(ctx, testConfig)
+	assert.Nil(t, err)
+
+	n, err := NewNearCache(ctx, client, nil, LocalMaxEntries(1))
+	assert.Nil(t, err)
+	assert.Nil(t, n.Set(ctx, "solo", "v", time.Minute))
+	v, err := n.Get(ctx, "solo")
+	assert.Nil(t, err)
+	assert.Equal(t, "v", v)
+	assert.Equal(t, 1, n.Local().Len())
+
+	assert.Nil(t, n.Invalidate(ctx, "solo"))
+	assert.Equal(t, 0, n.Local().Len())
+}
+
+func TestNearCacheRemoteTTL(t *testing.T) {
+	ctx := context.Background()
+	client, err := Init(ctx, testConfig)
+	assert.Nil(t, err)
+
+	n, err := NewNearCache(ctx, client, nil, LocalTTL(time.Minute))
+	assert.Nil(t, err)
+	assert.Nil(t, n.Set(ctx, "short", "v", 100*time.Millisecond))
+	v, err := n.Get(ctx, "short")
+	assert.Nil(t, err)
+	assert.Equal(t, "v", v)
+
+	// local copy expires with the key in redis instead of after local ttl
+	time.Sleep(150 * time.Millisecond)
+	_, ok := n.Local().Get("short")
+	assert.False(t, ok)
+}
+
+// downTransport is a pubsub transport which can not be reached
+type downTransport struct{}
+
+func (downTransport) Publish(ctx context.Context, topic string, data []byte) error {
+	return errors.New("connection refused")
+}
+
+func (downTransport) Subscribe(ctx context.Context, topic string, fn pubsub.DeliverFunc) error {
+	return errors.New("connection refused")
+}
+
+func TestNearCacheSubscribeError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client, err := Init(ctx, testConfig)
+	assert.Nil(t, err)
+
+	n, err := NewNearCache(ctx, client, pubsub.NewWithTransport(downTransport{}))
+	assert.NotNil(t, err)
+	assert.Nil(t, n)
+}
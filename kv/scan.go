@@ -0,0 +1,90 @@
+package kv
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/golang-tire/pkg/log"
+)
+
+// scanCount is the COUNT hint for each SCAN call and the batch size of DeletePrefix
+const scanCount = 100
+
+// Iterator iterate over keys matching a pattern using SCAN cursors
+type Iterator struct {
+	client *Client
+	it     *redis.ScanIterator
+}
+
+// Scan returns an iterator over keys matching given glob pattern in client namespace
+// returned keys do not contain the namespace prefix
+func (c *Client) Scan(ctx context.Context, pattern string) *Iterator {
+	return &Iterator{
+		client: c,
+		it:     c.conn().Scan(ctx, 0, c.Key(pattern), scanCount).Iterator(),
+	}
+}
+
+// Next advance the iterator, it returns false when there is no more keys or an error happened
+func (it *Iterator) Next(ctx context.Context) bool {
+	return it.it.Next(ctx)
+}
+
+// Key returns current key
+func (it *Iterator) Key() string {
+	return it.client.stripKey(it.it.Val())
+}
+
+// Err returns the iteration error if any
+func (it *Iterator) Err() error {
+	return it.it.Err()
+}
+
+// DeletePrefix remove all keys starting with prefix in batches and returns number of removed keys
+func (c *Client) DeletePrefix(ctx context.Context, prefix string) (int64, error) {
+	var (
+		removed int64
+		batch   = make([]string, 0, scanCount)
+		it      = c.Scan(ctx, escapePattern(prefix)+"*")
+	)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		n, err := c.conn().Unlink(ctx, c.keys(batch)...).Result()
+		if err != nil {
+			return err
+		}
+		removed += n
+		batch = batch[:0]
+		return nil
+	}
+
+	for it.Next(ctx) {
+		batch = append(batch, it.Key())
+		if len(batch) == scanCount {
+			if err := flush(); err != nil {
+				log.Error("kv: delete prefix error", log.Err(err))
+				return removed, err
+			}
+		}
+	}
+	if err := it.Err(); err != nil {
+		log.Error("kv: scan error", log.Err(err))
+		return removed, err
+	}
+	if err := flush(); err != nil {
+		log.Error("kv: delete prefix error", log.Err(err))
+		return removed, err
+	}
+	return removed, nil
+}
+
+var patternEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
+
+// escapePattern escape glob special characters
+func escapePattern(s string) string {
+	return patternEscaper.Replace(s)
+}
@@ -0,0 +1,71 @@
+package kv
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNamespace(t *testing.T) {
+	ctx := context.Background()
+	client, err := Init(ctx, &Config{
+		Host:      testConfig.Host,
+		Port:      testConfig.Port,
+		Namespace: "svc",
+	})
+	assert.Nil(t, err)
+	defer client.SetNamespace("")
+
+	err = client.Set("ns-key", "v", time.Minute)
+	assert.Nil(t, err)
+	assert.True(t, redisServer.Exists("svc:ns-key"))
+	assert.False(t, redisServer.Exists("ns-key"))
+
+	v, err := client.GetString("ns-key")
+	assert.Nil(t, err)
+	assert.Equal(t, "v", v)
+
+	vals, err := client.MGet(ctx, "ns-key")
+	assert.Nil(t, err)
+	assert.Equal(t, "v", vals["ns-key"])
+
+	err = client.Delete("ns-key")
+	assert.Nil(t, err)
+	assert.False(t, redisServer.Exists("svc:ns-key"))
+}
+
+func TestScanAndDeletePrefix(t *testing.T) {
+	ctx := context.Background()
+	client, err := Init(ctx, testConfig)
+	assert.Nil(t, err)
+	client.SetNamespace("scan")
+	defer client.SetNamespace("")
+
+	values := make(map[string]interface{})
+	for i := 0; i < 250; i++ {
+		values[fmt.Sprintf("user:%d", i)] = i
+	}
+	values["other:1"] = 1
+	assert.Nil(t, client.MSet(ctx, values, 0))
+	assert.Nil(t, redisServer.Set("user:outside", "x"))
+
+	var keys []string
+	it := client.Scan(ctx, "other:*")
+	for it.Next(ctx) {
+		keys = append(keys, it.Key())
+	}
+	assert.Nil(t, it.Err())
+	sort.Strings(keys)
+	assert.Equal(t, []string{"other:1"}, keys)
+
+	n, err := client.DeletePrefix(ctx, "user:")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(250), n)
+
+	assert.True(t, redisServer.Exists("scan:other:1"))
+	assert.True(t, redisServer.Exists("user:outside"))
+}
@@ -0,0 +1,54 @@
+package kv
+
+import (
+	"context"
+)
+
+// Set is a wrapper of redis set of string members
+type Set struct {
+	structure
+}
+
+// StringSet returns a wrapper of redis set stored at key
+func (c *Client) StringSet(key string) *Set {
+	return &Set{structure: newStructure(c, key)}
+}
+
+// Add add members to set and returns number of new members
+func (s *Set) Add(ctx context.Context, members ...string) (int64, error) {
+	return s.client.conn().SAdd(ctx, s.key, toInterfaces(members)...).Result()
+}
+
+// Remove remove members from set and returns number of removed members
+func (s *Set) Remove(ctx context.Context, members ...string) (int64, error) {
+	return s.client.conn().SRem(ctx, s.key, toInterfaces(members)...).Result()
+}
+
+// Members returns all members of set
+func (s *Set) Members(ctx context.Context) ([]string, error) {
+	return s.client.conn().SMembers(ctx, s.key).Result()
+}
+
+// IsMember check if member is in set
+func (s *Set) IsMember(ctx context.Context, member string) (bool, error) {
+	return s.client.conn().SIsMember(ctx, s.key, member).Result()
+}
+
+// Len returns number of members
+func (s *Set) Len(ctx context.Context) (int64, error) {
+	return s.client.conn().SCard(ctx, s.key).Result()
+}
+
+// Pop remove and return a random member, it returns ErrNotFound if set is empty
+func (s *Set) Pop(ctx context.Context) (string, error) {
+	v, err := s.client.conn().SPop(ctx, s.key).Result()
+	return v, notFound(err)
+}
+
+func toInterfaces(s []string) []interface{} {
+	res := make([]interface{}, len(s))
+	for i := range s {
+		res[i] = s[i]
+	}
+	return res
+}
@@ -0,0 +1,42 @@
+package kv
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStringSet(t *testing.T) {
+	ctx := context.Background()
+	client, err := Init(ctx, testConfig)
+	assert.Nil(t, err)
+
+	s := client.StringSet("tags")
+	n, err := s.Add(ctx, "a", "b", "a")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+
+	ok, err := s.IsMember(ctx, "a")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	members, err := s.Members(ctx)
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"a", "b"}, members)
+
+	n, err = s.Remove(ctx, "a")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+
+	n, err = s.Len(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+
+	m, err := s.Pop(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, "b", m)
+
+	_, err = s.Pop(ctx)
+	assert.Equal(t, ErrNotFound, err)
+}
@@ -0,0 +1,137 @@
+package kv
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ScoredMember is a sorted set member with its score
+type ScoredMember struct {
+	Member string
+	Score  float64
+}
+
+// SortedSet is a wrapper of redis sorted set, it can be used for leaderboards and delay queues
+type SortedSet struct {
+	structure
+}
+
+// SortedSet returns a wrapper of redis sorted set stored at key
+func (c *Client) SortedSet(key string) *SortedSet {
+	return &SortedSet{structure: newStructure(c, key)}
+}
+
+// Add add or update members
+func (z *SortedSet) Add(ctx context.Context, members ...ScoredMember) error {
+	zs := make([]*redis.Z, len(members))
+	for i := range members {
+		zs[i] = &redis.Z{Member: members[i].Member, Score: members[i].Score}
+	}
+	return z.client.conn().ZAdd(ctx, z.key, zs...).Err()
+}
+
+// Incr increment score of member by n and returns the new score
+func (z *SortedSet) Incr(ctx context.Context, member string, n float64) (float64, error) {
+	return z.client.conn().ZIncrBy(ctx, z.key, n, member).Result()
+}
+
+// Score returns score of member, it returns ErrNotFound if member does not exist
+func (z *SortedSet) Score(ctx context.Context, member string) (float64, error) {
+	v, err := z.client.conn().ZScore(ctx, z.key, member).Result()
+	return v, notFound(err)
+}
+
+// Rank returns rank of member ordered from low to high score, or high to low if reverse is true
+// it returns ErrNotFound if member does not exist
+func (z *SortedSet) Rank(ctx context.Context, member string, reverse bool) (int64, error) {
+	var cmd *redis.IntCmd
+	if reverse {
+		cmd = z.client.conn().ZRevRank(ctx, z.key, member)
+	} else {
+		cmd = z.client.conn().ZRank(ctx, z.key, member)
+	}
+	v, err := cmd.Result()
+	return v, notFound(err)
+}
+
+// Range returns members between start and stop ranks ordered from low to high score,
+// or high to low if reverse is true
+func (z *SortedSet) Range(ctx context.Context, start, stop int64, reverse bool) ([]ScoredMember, error) {
+	var cmd *redis.ZSliceCmd
+	if reverse {
+		cmd = z.client.conn().ZRevRangeWithScores(ctx, z.key, start, stop)
+	} else {
+		cmd = z.client.conn().ZRangeWithScores(ctx, z.key, start, stop)
+	}
+	return scoredMembers(cmd.Result())
+}
+
+// RangeByScore returns up to limit members with score between min and max, zero limit means all
+func (z *SortedSet) RangeByScore(ctx context.Context, min, max float64, limit int64) ([]ScoredMember, error) {
+	return scoredMembers(z.client.conn().ZRangeByScoreWithScores(ctx, z.key, &redis.ZRangeBy{
+		Min:   formatScore(min),
+		Max:   formatScore(max),
+		Count: limit,
+	}).Result())
+}
+
+// PopMin remove and returns up to count members with lowest scores
+func (z *SortedSet) PopMin(ctx context.Context, count int64) ([]ScoredMember, error) {
+	return scoredMembers(z.client.conn().ZPopMin(ctx, z.key, count).Result())
+}
+
+var popByScoreScript = redis.NewScript(`
+local items = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'WITHSCORES', 'LIMIT', 0, ARGV[2])
+for i = 1, #items, 2 do
+	redis.call('ZREM', KEYS[1], items[i])
+end
+return items
+`)
+
+// PopByScore atomically remove and returns up to count members with score lower than or equal
+// to max, e.g. due jobs of a delay queue scored by unix time
+func (z *SortedSet) PopByScore(ctx context.Context, max float64, count int64) ([]ScoredMember, error) {
+	v, err := popByScoreScript.Run(ctx, z.client.conn(), []string{z.key}, formatScore(max), count).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	items, _ := v.([]interface{})
+	res := make([]ScoredMember, 0, len(items)/2)
+	for i := 0; i+1 < len(items); i += 2 {
+		member, _ := items[i].(string)
+		score, err := strconv.ParseFloat(items[i+1].(string), 64)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, ScoredMember{Member: member, Score: score})
+	}
+	return res, nil
+}
+
+// Remove remove members and returns number of removed members
+func (z *SortedSet) Remove(ctx context.Context, members ...string) (int64, error) {
+	return z.client.conn().ZRem(ctx, z.key, toInterfaces(members)...).Result()
+}
+
+// Len returns number of members
+func (z *SortedSet) Len(ctx context.Context) (int64, error) {
+	return z.client.conn().ZCard(ctx, z.key).Result()
+}
+
+func scoredMembers(zs []redis.Z, err error) ([]ScoredMember, error) {
+	if err != nil {
+		return nil, err
+	}
+	res := make([]ScoredMember, len(zs))
+	for i := range zs {
+		res[i] = ScoredMember{Member: zs[i].Member.(string), Score: zs[i].Score}
+	}
+	return res, nil
+}
+
+func formatScore(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,62 @@
+package kv
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSortedSet(t *testing.T) {
+	ctx := context.Background()
+	client, err := Init(ctx, testConfig)
+	assert.Nil(t, err)
+
+	z := client.SortedSet("leaderboard")
+	err = z.Add(ctx, ScoredMember{Member: "a", Score: 10}, ScoredMember{Member: "b", Score: 20}, ScoredMember{Member: "c", Score: 5})
+	assert.Nil(t, err)
+
+	score, err := z.Incr(ctx, "c", 20)
+	assert.Nil(t, err)
+	assert.Equal(t, float64(25), score)
+
+	top, err := z.Range(ctx, 0, 1, true)
+	assert.Nil(t, err)
+	assert.Equal(t, []ScoredMember{{Member: "c", Score: 25}, {Member: "b", Score: 20}}, top)
+
+	rank, err := z.Rank(ctx, "a", false)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), rank)
+	rank, err = z.Rank(ctx, "a", true)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), rank)
+	_, err = z.Rank(ctx, "missing", false)
+	assert.Equal(t, ErrNotFound, err)
+
+	score, err = z.Score(ctx, "b")
+	assert.Nil(t, err)
+	assert.Equal(t, float64(20), score)
+	_, err = z.Score(ctx, "missing")
+	assert.Equal(t, ErrNotFound, err)
+
+	byScore, err := z.RangeByScore(ctx, 10, 20, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []ScoredMember{{Member: "a", Score: 10}, {Member: "b", Score: 20}}, byScore)
+
+	due, err := z.PopByScore(ctx, 20, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []ScoredMember{{Member: "a", Score: 10}, {Member: "b", Score: 20}}, due)
+
+	n, err := z.Len(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+
+	min, err := z.PopMin(ctx, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []ScoredMember{{Member: "c", Score: 25}}, min)
+
+	assert.Nil(t, z.Add(ctx, ScoredMember{Member: "d", Score: 1}))
+	n, err = z.Remove(ctx, "d")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+}
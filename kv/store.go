@@ -0,0 +1,79 @@
+package kv
+
+import (
+	"context"
+	"time"
+)
+
+// Store is a minimal key value store implemented by redis client, in memory and disk stores,
+// packages that need to run without redis should depend on it instead of Client
+type Store interface {
+	// Get returns value of key or ErrNotFound if it does not exist
+	Get(ctx context.Context, key string) (string, error)
+	// Set set value of key, zero ttl means it never expire
+	Set(ctx context.Context, key, value string, ttl time.Duration) error
+	// SetNX set value of key only if it does not exist and returns true if it was set
+	SetNX(ctx context.Context, key, value string, ttl time.Duration) (bool, error)
+	// Delete remove keys
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// Store returns client as a Store
+func (c *Client) Store() Store {
+	return redisStore{client: c}
+}
+
+type redisStore struct {
+	client *Client
+}
+
+func (s redisStore) Get(ctx context.Context, key string) (string, error) {
+	v, err := s.client.conn().Get(ctx, s.client.Key(key)).Result()
+	return v, notFound(err)
+}
+
+func (s redisStore) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	return s.client.conn().Set(ctx, s.client.Key(key), value, ttl).Err()
+}
+
+func (s redisStore) SetNX(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	return s.client.conn().SetNX(ctx, s.client.Key(key), value, ttl).Result()
+}
+
+func (s redisStore) Delete(ctx context.Context, keys ...string) error {
+	_, err := s.client.MDelete(ctx, keys...)
+	return err
+}
+
+// Store returns in memory kv as a Store
+func (i *InMemory) Store() Store {
+	return memoryStore{memory: i}
+}
+
+type memoryStore struct {
+	memory *InMemory
+}
+
+func (s memoryStore) Get(ctx context.Context, key string) (string, error) {
+	v, ok := s.memory.Get(key)
+	if !ok {
+		return "", ErrNotFound
+	}
+	return v, nil
+}
+
+func (s memoryStore) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	s.memory.SetWithTTL(key, value, ttl)
+	return nil
+}
+
+func (s memoryStore) SetNX(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	return s.memory.SetNX(key, value, ttl), nil
+}
+
+func (s memoryStore) Delete(ctx context.Context, keys ...string) error {
+	for _, k := range keys {
+		s.memory.Delete(k)
+	}
+	return nil
+}
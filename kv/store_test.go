@@ -0,0 +1,48 @@
+package kv
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStores(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client, err := Init(ctx, testConfig)
+	assert.Nil(t, err)
+	disk, err := OpenDisk(ctx, filepath.Join(t.TempDir(), "kv.log"))
+	assert.Nil(t, err)
+
+	stores := map[string]Store{
+		"redis":  client.Store(),
+		"memory": NewInMemory(ctx).Store(),
+		"disk":   disk,
+	}
+
+	for name, s := range stores {
+		t.Run(name, func(t *testing.T) {
+			assert.Nil(t, s.Set(ctx, "store-key", "v", time.Minute))
+			v, err := s.Get(ctx, "store-key")
+			assert.Nil(t, err)
+			assert.Equal(t, "v", v)
+
+			ok, err := s.SetNX(ctx, "store-key", "v2", time.Minute)
+			assert.Nil(t, err)
+			assert.False(t, ok)
+
+			assert.Nil(t, s.Delete(ctx, "store-key"))
+			_, err = s.Get(ctx, "store-key")
+			assert.Equal(t, ErrNotFound, err)
+
+			ok, err = s.SetNX(ctx, "store-key", "v2", time.Minute)
+			assert.Nil(t, err)
+			assert.True(t, ok)
+			assert.Nil(t, s.Delete(ctx, "store-key"))
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package kv
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// StreamMessage is a single entry of a redis stream
+type StreamMessage struct {
+	ID     string
+	Values map[string]interface{}
+}
+
+// Stream is a wrapper of redis stream
+type Stream struct {
+	structure
+}
+
+// Stream returns a wrapper of redis stream stored at key
+func (c *Client) Stream(key string) *Stream {
+	return &Stream{structure: newStructure(c, key)}
+}
+
+// Add append a message to stream and returns its id
+func (s *Stream) Add(ctx context.Context, values map[string]interface{}) (string, error) {
+	return s.AddCapped(ctx, 0, values)
+}
+
+// AddCapped append a message to stream and keep stream length around maxLen, zero maxLen means unlimited
+func (s *Stream) AddCapped(ctx context.Context, maxLen int64, values map[string]interface{}) (string, error) {
+	return s.client.conn().XAdd(ctx, &redis.XAddArgs{
+		Stream:       s.key,
+		MaxLenApprox: maxLen,
+		Values:       values,
+	}).Result()
+}
+
+// Read returns up to count messages after lastID, use "0" to read from beginning and "$" to read
+// only new messages, if block is not zero it will wait up to block for new messages
+// it returns ErrNotFound if there is no message
+func (s *Stream) Read(ctx context.Context, lastID string, count int64, block time.Duration) ([]StreamMessage, error) {
+	if block == 0 {
+		// go-redis will not send BLOCK when it's negative
+		block = -1
+	}
+	streams, err := s.client.conn().XRead(ctx, &redis.XReadArgs{
+		Streams: []string{s.key, lastID},
+		Count:   count,
+		Block:   block,
+	}).Result()
+	if err != nil {
+		return nil, notFound(err)
+	}
+	if len(streams) == 0 || len(streams[0].Messages) == 0 {
+		return nil, ErrNotFound
+	}
+	return streamMessages(streams[0].Messages), nil
+}
+
+// Range returns messages with id between start and stop, "-" and "+" are the lowest and highest ids
+func (s *Stream) Range(ctx context.Context, start, stop string) ([]StreamMessage, error) {
+	msgs, err := s.client.conn().XRange(ctx, s.key, start, stop).Result()
+	if err != nil {
+		return nil, err
+	}
+	return streamMessages(msgs), nil
+}
+
+// Delete remove messages by id
+func (s *Stream) Delete(ctx context.Context, ids ...string) error {
+	return s.client.conn().XDel(ctx, s.key, ids...).Err()
+}
+
+// Len returns number of messages in stream
+func (s *Stream) Len(ctx context.Context) (int64, error) {
+	return s.client.conn().XLen(ctx, s.key).Result()
+}
+
+func streamMessages(msgs []redis.XMessage) []StreamMessage {
+	res := make([]StreamMessage, len(msgs))
+	for i := range msgs {
+		res[i] = StreamMessage{ID: msgs[i].ID, Values: msgs[i].Values}
+	}
+	return res
+}
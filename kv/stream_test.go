@@ -0,0 +1,46 @@
+package kv
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStream(t *testing.T) {
+	ctx := context.Background()
+	client, err := Init(ctx, testConfig)
+	assert.Nil(t, err)
+
+	// key is unique per run since miniredis is shared by tests
+	s := client.Stream("events:" + uuid.New().String())
+	id1, err := s.Add(ctx, map[string]interface{}{"type": "created"})
+	assert.Nil(t, err)
+	id2, err := s.AddCapped(ctx, 100, map[string]interface{}{"type": "updated"})
+	assert.Nil(t, err)
+
+	n, err := s.Len(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+
+	msgs, err := s.Read(ctx, "0", 10, 0)
+	assert.Nil(t, err)
+	assert.Len(t, msgs, 2)
+	assert.Equal(t, id1, msgs[0].ID)
+	assert.Equal(t, "created", msgs[0].Values["type"])
+
+	msgs, err = s.Read(ctx, id1, 10, 0)
+	assert.Nil(t, err)
+	assert.Len(t, msgs, 1)
+	assert.Equal(t, id2, msgs[0].ID)
+
+	_, err = s.Read(ctx, id2, 10, 0)
+	assert.Equal(t, ErrNotFound, err)
+
+	assert.Nil(t, s.Delete(ctx, id2))
+	msgs, err = s.Range(ctx, "-", "+")
+	assert.Nil(t, err)
+	assert.Len(t, msgs, 1)
+	assert.Equal(t, "created", msgs[0].Values["type"])
+}
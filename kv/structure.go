@@ -0,0 +1,31 @@
+package kv
+
+import (
+	"context"
+	"time"
+)
+
+// structure is the common part of redis data structure wrappers
+type structure struct {
+	client *Client
+	key    string
+}
+
+func newStructure(c *Client, key string) structure {
+	return structure{client: c, key: c.Key(key)}
+}
+
+// Key returns the redis key of data structure
+func (s structure) Key() string {
+	return s.key
+}
+
+// Expire set a timeout on the data structure key
+func (s structure) Expire(ctx context.Context, alive time.Duration) error {
+	return s.client.conn().Expire(ctx, s.key, alive).Err()
+}
+
+// Clear remove the data structure key
+func (s structure) Clear(ctx context.Context) error {
+	return s.client.conn().Del(ctx, s.key).Err()
+}
@@ -0,0 +1,255 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// ContentTypeProtobuf is content type of messages published by Publish
+const ContentTypeProtobuf = "application/protobuf"
+
+// envelopeMagic is prefix of encoded envelopes, a proto message never starts with a zero byte
+// since field number zero is invalid, so messages published before envelopes are still readable
+var envelopeMagic = []byte{0x00, 0x01}
+
+// envelope field numbers, it's wire compatible with
+//
+//	message Envelope {
+//	  string id = 1;
+//	  int64 published_at = 2; // unix nano
+//	  string content_type = 3;
+//	  string type = 4;
+//	  map<string, string> headers = 5;
+//	  bytes payload = 6;
+//	}
+const (
+	envelopeID protowire.Number = iota + 1
+	envelopePublishedAt
+	envelopeContentType
+	envelopeType
+	envelopeHeaders
+	envelopePayload
+)
+
+var errInvalidEnvelope = errors.New("pubsub: invalid envelope")
+
+// Envelope is a published message with its metadata
+type Envelope struct {
+	// ID is unique id of message, it can be used to dedupe redelivered messages
+	ID          string
+	PublishedAt time.Time
+	ContentType string
+	// Type is proto full name of message, e.g. "users.v1.UserCreated"
+	Type    string
+	Headers map[string]string
+	Payload []byte
+}
+
+// newEnvelope wrap msg with headers of ctx
+func newEnvelope(ctx context.Context, msg proto.Message) (*Envelope, error) {
+	payload, err := proto.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	return &Envelope{
+		ID:          uuid.New().String(),
+		PublishedAt: time.Now(),
+		ContentType: ContentTypeProtobuf,
+		Type:        proto.MessageName(msg),
+		Headers:     outgoingHeaders(ctx),
+		Payload:     payload,
+	}, nil
+}
+
+// Marshal encode envelope
+func (e *Envelope) Marshal() []byte {
+	b := append([]byte(nil), envelopeMagic...)
+	b = appendString(b, envelopeID, e.ID)
+	if !e.PublishedAt.IsZero() {
+		b = protowire.AppendTag(b, envelopePublishedAt, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(e.PublishedAt.UnixNano()))
+	}
+	b = appendString(b, envelopeContentType, e.ContentType)
+	b = appendString(b, envelopeType, e.Type)
+	for k, v := range e.Headers {
+		var entry []byte
+		entry = appendString(entry, 1, k)
+		entry = appendString(entry, 2, v)
+		b = protowire.AppendTag(b, envelopeHeaders, protowire.BytesType)
+		b = protowire.AppendBytes(b, entry)
+	}
+	if len(e.Payload) > 0 {
+		b = protowire.AppendTag(b, envelopePayload, protowire.BytesType)
+		b = protowire.AppendBytes(b, e.Payload)
+	}
+	return b
+}
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+// UnmarshalEnvelope decode an encoded envelope, data without envelope is returned as payload
+// of an envelope without metadata
+func UnmarshalEnvelope(data []byte) (*Envelope, error) {
+	if len(data) < len(envelopeMagic) || data[0] != envelopeMagic[0] {
+		return &Envelope{Payload: data}, nil
+	}
+	if data[1] != envelopeMagic[1] {
+		return nil, errInvalidEnvelope
+	}
+
+	e := &Envelope{}
+	b := data[len(envelopeMagic):]
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, errInvalidEnvelope
+		}
+		b = b[n:]
+
+		switch {
+		case num == envelopePublishedAt && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return nil, errInvalidEnvelope
+			}
+			e.PublishedAt = time.Unix(0, int64(v))
+			b = b[n:]
+		case typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return nil, errInvalidEnvelope
+			}
+			b = b[n:]
+			if err := e.setField(num, v); err != nil {
+				return nil, err
+			}
+		default:
+			// unknown fields are skipped for forward compatibility
+			n := protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return nil, errInvalidEnvelope
+			}
+			b = b[n:]
+		}
+	}
+	return e, nil
+}
+
+func (e *Envelope) setField(num protowire.Number, v []byte) error {
+	switch num {
+	case envelopeID:
+		e.ID = string(v)
+	case envelopeContentType:
+		e.ContentType = string(v)
+	case envelopeType:
+		e.Type = string(v)
+	case envelopePayload:
+		e.Payload = append([]byte(nil), v...)
+	case envelopeHeaders:
+		k, val, err := consumeHeader(v)
+		if err != nil {
+			return err
+		}
+		if e.Headers == nil {
+			e.Headers = make(map[string]string)
+		}
+		e.Headers[k] = val
+	}
+	return nil
+}
+
+// consumeHeader decode a map entry of headers
+func consumeHeader(b []byte) (string, string, error) {
+	var k, v string
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return "", "", errInvalidEnvelope
+		}
+		b = b[n:]
+		if typ != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return "", "", errInvalidEnvelope
+			}
+			b = b[n:]
+			continue
+		}
+		s, n := protowire.ConsumeString(b)
+		if n < 0 {
+			return "", "", errInvalidEnvelope
+		}
+		b = b[n:]
+		switch num {
+		case 1:
+			k = s
+		case 2:
+			v = s
+		}
+	}
+	return k, v, nil
+}
+
+type (
+	headersCtxKey  struct{}
+	envelopeCtxKey struct{}
+)
+
+// WithHeader returns a context that add header to messages published with it, e.g. trace
+// context, tenant or correlation id
+func WithHeader(ctx context.Context, key, value string) context.Context {
+	return WithHeaders(ctx, map[string]string{key: value})
+}
+
+// WithHeaders returns a context that add all headers to messages published with it
+func WithHeaders(ctx context.Context, headers map[string]string) context.Context {
+	merged := make(map[string]string, len(headers))
+	for k, v := range outgoingHeaders(ctx) {
+		merged[k] = v
+	}
+	for k, v := range headers {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, headersCtxKey{}, merged)
+}
+
+// outgoingHeaders returns headers set on ctx using WithHeader
+func outgoingHeaders(ctx context.Context) map[string]string {
+	headers, _ := ctx.Value(headersCtxKey{}).(map[string]string)
+	return headers
+}
+
+// newEnvelopeContext returns a context that carry envelope of message being handled, headers
+// of envelope are also added to messages published with the context so they are propagated
+func newEnvelopeContext(ctx context.Context, e *Envelope) context.Context {
+	ctx = context.WithValue(ctx, envelopeCtxKey{}, e)
+	if len(e.Headers) > 0 {
+		ctx = WithHeaders(ctx, e.Headers)
+	}
+	return ctx
+}
+
+// EnvelopeFromContext returns envelope of message being handled, or nil if there is none
+func EnvelopeFromContext(ctx context.Context) *Envelope {
+	e, _ := ctx.Value(envelopeCtxKey{}).(*Envelope)
+	return e
+}
+
+// HeaderFromContext returns a header of message being handled
+func HeaderFromContext(ctx context.Context, key string) string {
+	if e := EnvelopeFromContext(ctx); e != nil {
+		return e.Headers[key]
+	}
+	return ""
+}
@@ -0,0 +1,108 @@
+package pubsub
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/golang-tire/pkg/pubsub/test"
+)
+
+func TestEnvelope(t *testing.T) {
+	e := &Envelope{
+		ID:          "id",
+		PublishedAt: time.Unix(0, 1600000000000000001),
+		ContentType: ContentTypeProtobuf,
+		Type:        "pkg.test.HelloWorld",
+		Headers:     map[string]string{"tenant": "acme", "trace": "abc"},
+		Payload:     []byte("payload"),
+	}
+	got, err := UnmarshalEnvelope(e.Marshal())
+	assert.Nil(t, err)
+	assert.Equal(t, e.ID, got.ID)
+	assert.True(t, e.PublishedAt.Equal(got.PublishedAt))
+	assert.Equal(t, e.ContentType, got.ContentType)
+	assert.Equal(t, e.Type, got.Type)
+	assert.Equal(t, e.Headers, got.Headers)
+	assert.Equal(t, e.Payload, got.Payload)
+
+	// messages published without envelope
+	raw, err := proto.Marshal(&test.HelloWorld{Name: "raw"})
+	assert.Nil(t, err)
+	got, err = UnmarshalEnvelope(raw)
+	assert.Nil(t, err)
+	assert.Equal(t, raw, got.Payload)
+	assert.Empty(t, got.ID)
+
+	_, err = UnmarshalEnvelope([]byte{0x00, 0x02})
+	assert.NotNil(t, err)
+	_, err = UnmarshalEnvelope(append(e.Marshal()[:10], 0xff))
+	assert.NotNil(t, err)
+}
+
+func TestEnvelopeContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	service := New(redisClient)
+	envelopes := make(chan *Envelope, 2)
+	handler := func(ctx context.Context, msg proto.Message) error {
+		envelopes <- EnvelopeFromContext(ctx)
+		if HeaderFromContext(ctx, "hop") == "" {
+			// headers of handled message are propagated to published messages
+			return service.Publish(WithHeader(ctx, "hop", "2"), "envelope-topic", msg)
+		}
+		return nil
+	}
+	_, err := service.SubscribeFunc(ctx, "envelope-topic", helloFactory, handler)
+	assert.Nil(t, err)
+	time.Sleep(50 * time.Millisecond)
+
+	pubCtx := WithHeaders(ctx, map[string]string{"correlation-id": "c1", "tenant": "acme"})
+	assert.Nil(t, service.Publish(pubCtx, "envelope-topic", &test.HelloWorld{Name: "hi"}))
+
+	var first, second *Envelope
+	for _, e := range []**Envelope{&first, &second} {
+		select {
+		case *e = <-envelopes:
+		case <-time.After(time.Second):
+			t.Fatal("message is not received")
+		}
+	}
+
+	assert.NotEmpty(t, first.ID)
+	assert.Equal(t, ContentTypeProtobuf, first.ContentType)
+	assert.Equal(t, "test.HelloWorld", first.Type)
+	assert.WithinDuration(t, time.Now(), first.PublishedAt, time.Second)
+	assert.Equal(t, map[string]string{"correlation-id": "c1", "tenant": "acme"}, first.Headers)
+
+	assert.NotEqual(t, first.ID, second.ID)
+	assert.Equal(t, map[string]string{"correlation-id": "c1", "tenant": "acme", "hop": "2"}, second.Headers)
+}
+
+func TestRawMessage(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	service := New(redisClient)
+	received := make(chan string, 1)
+	_, err := service.SubscribeFunc(ctx, "raw-topic", helloFactory, func(ctx context.Context, msg proto.Message) error {
+		received <- msg.(*test.HelloWorld).Name
+		return nil
+	})
+	assert.Nil(t, err)
+	time.Sleep(50 * time.Millisecond)
+
+	raw, err := proto.Marshal(&test.HelloWorld{Name: "raw"})
+	assert.Nil(t, err)
+	assert.Nil(t, redisClient.Publish(ctx, "raw-topic", raw).Err())
+	select {
+	case got := <-received:
+		assert.Equal(t, "raw", got)
+	case <-time.After(time.Second):
+		t.Fatal("message is not received")
+	}
+}
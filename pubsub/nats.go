@@ -0,0 +1,60 @@
+package pubsub
+
+import (
+	"context"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/golang-tire/pkg/log"
+)
+
+// natsTransport use core NATS subjects, like redis pub/sub messages are lost if there is no subscriber
+type natsTransport struct {
+	conn  *nats.Conn
+	queue string
+}
+
+// NewNATSTransport returns a Transport which use a NATS connection, topics are used as subjects.
+// If queue is not empty subscribers join the queue group so each message is handled by one
+// instance of a service
+func NewNATSTransport(conn *nats.Conn, queue string) Transport {
+	return &natsTransport{conn: conn, queue: queue}
+}
+
+func (t *natsTransport) Publish(ctx context.Context, topic string, data []byte) error {
+	return t.conn.Publish(topic, data)
+}
+
+func (t *natsTransport) Subscribe(ctx context.Context, topic string, fn DeliverFunc) error {
+	handle := func(msg *nats.Msg) {
+		go func() {
+			_ = fn(ctx, msg.Data)
+		}()
+	}
+
+	var (
+		sub *nats.Subscription
+		err error
+	)
+	if t.queue != "" {
+		sub, err = t.conn.QueueSubscribe(topic, t.queue, handle)
+	} else {
+		sub, err = t.conn.Subscribe(topic, handle)
+	}
+	if err != nil {
+		return err
+	}
+	// make sure server has the subscription so messages published after Subscribe returns are received
+	if err := t.conn.Flush(); err != nil {
+		_ = sub.Unsubscribe()
+		return err
+	}
+
+	go func() {
+		<-ctx.Done()
+		if err := sub.Unsubscribe(); err != nil && err != nats.ErrConnectionClosed {
+			log.Error("close subscriber failed", log.String("topic", topic), log.Err(err))
+		}
+	}()
+	return nil
+}
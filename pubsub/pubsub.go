@@ -2,43 +2,162 @@ package pubsub
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/golang/protobuf/proto"
 
-	"github.com/golang-tire/pkg/log"
-
 	"github.com/go-redis/redis/v8"
+
+	"github.com/golang-tire/pkg/log"
 )
 
+// ErrInvalidHandler is returned when a handler or its message factory is not usable
+var ErrInvalidHandler = errors.New("pubsub: invalid handler")
+
+var errNoTopic = errors.New("pubsub: topic is required")
+
+// resubscribePolicy is backoff of retrying subscriptions of Subscribe which failed on transport
+var resubscribePolicy = RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 30 * time.Second}.withDefaults()
+
 var pubSubSrv *service
 
 type service struct {
-	lock        sync.RWMutex
-	redisClient *redis.Client
-	topics      map[string]*Topic
+	lock      sync.RWMutex
+	transport Transport
+	topics    map[string]*Topic
+	opts      serviceOptions
 }
 
 // Topic topic holder that contain handlers lists
 type Topic struct {
-	handlers []Handler
+	handlers []*handler
+	// cancel stops transport subscription of topic, it's nil when topic has no handler
+	cancel context.CancelFunc
+}
+
+type serviceOptions struct {
+	streams     map[string]StreamConfig
+	transports  map[string]Transport
+	deadLetters Transport
+	retry       RetryPolicy
+}
+
+// An Option sets options such as backend of topics
+type Option interface {
+	apply(*serviceOptions)
+}
+
+// funcOption wraps a function that modifies serviceOptions into an
+// implementation of the Option interface.
+type funcOption struct {
+	f func(*serviceOptions)
+}
+
+func (fo *funcOption) apply(o *serviceOptions) {
+	fo.f(o)
+}
+
+func newFuncOption(f func(*serviceOptions)) *funcOption {
+	return &funcOption{
+		f: f,
+	}
 }
 
 // Handler is an interface and will contain target function to run in subscriber
 type Handler interface{}
 
+// HandlerFunc handle a message of a topic, failed calls are retried and then
+// message is sent to dead letter topic of topic
+type HandlerFunc func(ctx context.Context, msg proto.Message) error
+
+// handler is a subscribed handler with factory of its message type, ctx is context of
+// its subscription which is done when it's unsubscribed. name identifies handler in its
+// topic so dead letters can be replayed to the handler which failed
+type handler struct {
+	ctx    context.Context
+	name   string
+	newMsg func() proto.Message
+	fn     HandlerFunc
+}
+
+// funcName returns name of function fn, e.g. "github.com/org/svc.(*Users).OnCreated"
+func funcName(fn interface{}) string {
+	if f := runtime.FuncForPC(reflect.ValueOf(fn).Pointer()); f != nil {
+		return f.Name()
+	}
+	return "handler"
+}
+
 // Service pubsub service
 type Service interface {
 	Publish(ctx context.Context, topic string, msg proto.Message) error
 	Subscribe(ctx context.Context, topic string, handler Handler)
+	SubscribeFunc(ctx context.Context, topic string, newMsg func() proto.Message, fn HandlerFunc) (*Subscription, error)
+	Replay(ctx context.Context, d *DeadLetter) error
+}
+
+// WithTransport returns an Option that use t for topic instead of default transport of service
+func WithTransport(topic string, t Transport) Option {
+	return newFuncOption(func(o *serviceOptions) {
+		o.transports[topic] = t
+	})
+}
+
+// WithDeadLetterTransport returns an Option that use t for dead letter topics which are not
+// configured using WithTransport or WithStream
+func WithDeadLetterTransport(t Transport) Option {
+	return newFuncOption(func(o *serviceOptions) {
+		o.deadLetters = t
+	})
+}
+
+// New create a new instance of pubsub service, topics use redis PUBLISH unless they are
+// configured to use streams using WithStream. Dead letter topics use redis streams by default
+// so dead letters are kept until they are consumed even if nothing is subscribed to them
+func New(client *redis.Client, opts ...Option) Service {
+	o := newServiceOptions(opts)
+	for topic, cfg := range o.streams {
+		if _, ok := o.transports[topic]; !ok {
+			o.transports[topic] = NewStreamTransport(client, cfg)
+		}
+	}
+	if o.deadLetters == nil {
+		o.deadLetters = NewStreamTransport(client, StreamConfig{})
+	}
+	return newService(NewRedisTransport(client), o)
+}
+
+// NewWithTransport create a new instance of pubsub service which use t for topics, e.g.
+// NewMemoryTransport in unit tests. Dead letter topics use t too unless WithDeadLetterTransport
+// is set, so a durable one should be set if t drops messages which have no subscriber
+func NewWithTransport(t Transport, opts ...Option) Service {
+	return newService(t, newServiceOptions(opts))
 }
 
-// New create a new instance of pubsub service
-func New(client *redis.Client) Service {
+func newServiceOptions(opts []Option) serviceOptions {
+	o := serviceOptions{
+		streams:    make(map[string]StreamConfig),
+		transports: make(map[string]Transport),
+		retry:      RetryPolicy{}.withDefaults(),
+	}
+	for _, opt := range opts {
+		opt.apply(&o)
+	}
+	return o
+}
+
+func newService(t Transport, o serviceOptions) *service {
 	pubSubSrv = &service{
-		redisClient: client,
-		topics:      make(map[string]*Topic),
+		transport: t,
+		topics:    make(map[string]*Topic),
+		opts:      o,
 	}
 	return pubSubSrv
 }
@@ -62,68 +181,272 @@ func (s *service) getOrCreateTopic(topic string) *Topic {
 // Publish send a proto message to a topic.
 func (s *service) Publish(ctx context.Context, topic string, msg proto.Message) error {
 	s.lock.Lock()
-	defer s.lock.Unlock()
-
 	s.getOrCreateTopic(topic)
+	s.lock.Unlock()
 
-	m, err := proto.Marshal(msg)
+	e, err := newEnvelope(ctx, msg)
 	if err != nil {
 		return err
 	}
-	return s.redisClient.Publish(ctx, topic, m).Err()
+	return s.publishRaw(ctx, topic, e.Marshal())
+}
+
+// publishRaw send an encoded message to a topic
+func (s *service) publishRaw(ctx context.Context, topic string, data []byte) error {
+	return s.transportOf(topic).Publish(ctx, topic, data)
+}
+
+// transportOf returns transport of topic
+func (s *service) transportOf(topic string) Transport {
+	if t, ok := s.opts.transports[topic]; ok {
+		return t
+	}
+	if s.opts.deadLetters != nil && strings.HasSuffix(topic, deadLetterSuffix) {
+		return s.opts.deadLetters
+	}
+	return s.transport
+}
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	messageType = reflect.TypeOf((*proto.Message)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// reflectHandler convert a func(ctx context.Context, msg *T) or func(ctx context.Context, msg *T) error
+// handler to a message factory and HandlerFunc, *T must implement proto.Message
+func reflectHandler(h Handler) (func() proto.Message, HandlerFunc, error) {
+	// Reflection is slow, but this is done only once on subscriber setup
+	handlerFunc := reflect.TypeOf(h)
+	if handlerFunc == nil || handlerFunc.Kind() != reflect.Func {
+		return nil, nil, fmt.Errorf("%w: handler needs to be a func", ErrInvalidHandler)
+	}
+
+	if handlerFunc.NumIn() != 2 {
+		return nil, nil, fmt.Errorf("%w: handler should be of format func(ctx context.Context, msg *T) error", ErrInvalidHandler)
+	}
+
+	if handlerFunc.In(0) != contextType {
+		return nil, nil, fmt.Errorf("%w: first arg of handler is not context.Context", ErrInvalidHandler)
+	}
+
+	msgType := handlerFunc.In(1)
+	if msgType.Kind() != reflect.Ptr || !msgType.Implements(messageType) {
+		return nil, nil, fmt.Errorf("%w: second arg of handler is not a pointer to a proto.Message", ErrInvalidHandler)
+	}
+
+	switch {
+	case handlerFunc.NumOut() == 0:
+	case handlerFunc.NumOut() == 1 && handlerFunc.Out(0) == errorType:
+	default:
+		return nil, nil, fmt.Errorf("%w: handler should return nothing or an error", ErrInvalidHandler)
+	}
+
+	fn := reflect.ValueOf(h)
+	newMsg := func() proto.Message {
+		return reflect.New(msgType.Elem()).Interface().(proto.Message)
+	}
+	return newMsg, func(ctx context.Context, msg proto.Message) error {
+		out := fn.Call([]reflect.Value{reflect.ValueOf(ctx), reflect.ValueOf(msg)})
+		if len(out) == 1 && !out[0].IsNil() {
+			return out[0].Interface().(error)
+		}
+		return nil
+	}, nil
 }
 
 // Subscribe subscribe on a topic
-// handler function should be of format func(ctx context.Context, msg *proto.Message)
+// handler function should be of format func(ctx context.Context, msg *T) or
+// func(ctx context.Context, msg *T) error where *T is a proto message, it panics on
+// invalid handlers so SubscribeFunc should be preferred. Failed subscriptions on transport are
+// logged and retried in background. Handler is unsubscribed when ctx is done
 func (s *service) Subscribe(ctx context.Context, topic string, handler Handler) {
+	newMsg, fn, err := reflectHandler(handler)
+	if err != nil {
+		panic(err)
+	}
+	name := funcName(handler)
+	_, err = s.subscribe(ctx, topic, name, newMsg, fn)
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrInvalidHandler):
+		panic(err)
+	case err == errNoTopic:
+		log.Error("subscribe failed", log.Err(err))
+	default:
+		log.Error("subscribe failed", log.String("topic", topic), log.Err(err))
+		go s.resubscribe(ctx, topic, name, newMsg, fn)
+	}
+}
+
+// resubscribe retry a subscription of Subscribe until it succeeds or ctx is done
+func (s *service) resubscribe(ctx context.Context, topic, name string, newMsg func() proto.Message, fn HandlerFunc) {
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(resubscribePolicy.backoff(attempt)):
+		}
+		_, err := s.subscribe(ctx, topic, name, newMsg, fn)
+		if err == nil {
+			return
+		}
+		log.Error("subscribe failed", log.String("topic", topic), log.Any("attempt", attempt), log.Err(err))
+	}
+}
+
+// SubscribeFunc subscribe fn on a topic, each message is decoded into a new message
+// created by newMsg e.g. func() proto.Message { return &pb.Event{} }.
+// Topics have one subscription on their transport which is shared by all handlers, and each
+// handler receives a message once. fn is unsubscribed when ctx is done or Unsubscribe is called.
+// Handler is named after fn, see Subscription.Handler
+func (s *service) SubscribeFunc(ctx context.Context, topic string, newMsg func() proto.Message, fn HandlerFunc) (*Subscription, error) {
+	return s.subscribe(ctx, topic, funcName(fn), newMsg, fn)
+}
+
+func (s *service) subscribe(ctx context.Context, topic, name string, newMsg func() proto.Message, fn HandlerFunc) (*Subscription, error) {
+	if topic == "" {
+		return nil, errNoTopic
+	}
+	if newMsg == nil || fn == nil {
+		return nil, fmt.Errorf("%w: message factory and handler are required", ErrInvalidHandler)
+	}
+	if newMsg() == nil {
+		return nil, fmt.Errorf("%w: message factory returned nil", ErrInvalidHandler)
+	}
+
+	hctx, cancel := context.WithCancel(ctx)
+	h := &handler{ctx: hctx, name: name, newMsg: newMsg, fn: fn}
+	if err := s.addHandler(topic, h); err != nil {
+		cancel()
+		return nil, err
+	}
+
+	sub := &Subscription{topic: topic, handler: h.name, cancel: cancel, done: make(chan struct{})}
+	go func() {
+		<-hctx.Done()
+		s.removeHandler(topic, h)
+		close(sub.done)
+	}()
+	return sub, nil
+}
+
+// addHandler add h to handlers of topic and subscribe topic on its transport if it's the first handler
+func (s *service) addHandler(topic string, h *handler) error {
 	s.lock.Lock()
 	defer s.lock.Unlock()
 
-	// Reflection is slow, but this is done only once on subscriber setup
-	handlerFunc := reflect.TypeOf(handler)
-	if handlerFunc.Kind() != reflect.Func {
-		panic("pubsub: handler needs to be a func")
+	tp := s.getOrCreateTopic(topic)
+	if tp.cancel == nil {
+		// transport subscription is not bound to context of a handler since it's shared
+		ctx, cancel := context.WithCancel(context.Background())
+		if err := s.transportOf(topic).Subscribe(ctx, topic, func(ctx context.Context, data []byte) error {
+			return s.deliver(topic, tp, data)
+		}); err != nil {
+			cancel()
+			return err
+		}
+		tp.cancel = cancel
 	}
-
-	if handlerFunc.NumIn() != 2 {
-		panic(`pubsub: handler should be of format
-		func(ctx context.Context, msg *proto.Message)
-		but didn't receive enough args`)
+	// handlers of the same function are numbered in order of subscription
+	name, n := h.name, 1
+	for s.hasHandler(tp, name) {
+		n++
+		name = h.name + "#" + strconv.Itoa(n)
 	}
+	h.name = name
+	tp.handlers = append(tp.handlers, h)
+	return nil
+}
 
-	if handlerFunc.In(0) != reflect.TypeOf((*context.Context)(nil)).Elem() {
-		panic(`pubsub: handler should be of format
-		func(ctx context.Context, msg *proto.Message)
-		but first arg was not context.Context`)
+// hasHandler check if topic has a handler with given name, caller must hold the lock
+func (s *service) hasHandler(tp *Topic, name string) bool {
+	for _, h := range tp.handlers {
+		if h.name == name {
+			return true
+		}
 	}
+	return false
+}
+
+// removeHandler remove h from handlers of topic and stop transport subscription of topic if it was the last one
+func (s *service) removeHandler(topic string, h *handler) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
 
 	tp := s.getOrCreateTopic(topic)
-	tp.handlers = append(tp.handlers, handler)
-	ps := s.redisClient.Subscribe(ctx, topic)
+	// a new slice is built since deliver may iterate the old one
+	handlers := make([]*handler, 0, len(tp.handlers))
+	for _, th := range tp.handlers {
+		if th != h {
+			handlers = append(handlers, th)
+		}
+	}
+	tp.handlers = handlers
 
-	go func() {
-		ch := ps.Channel()
-		for msg := range ch {
-			if msg.Channel == topic {
-				obj := reflect.New(handlerFunc.In(1).Elem()).Interface()
-				err := proto.Unmarshal([]byte(msg.Payload), obj.(proto.Message))
-				if err != nil {
-					log.Error("unmarshal data failed", log.String("topic", topic), log.Err(err))
-					continue
-				}
-				for _, h := range tp.handlers {
-					fn := reflect.ValueOf(h)
-					go func() {
-						fn.Call([]reflect.Value{reflect.ValueOf(ctx), reflect.ValueOf(obj)})
-					}()
-				}
+	if len(handlers) == 0 && tp.cancel != nil {
+		tp.cancel()
+		tp.cancel = nil
+	}
+}
+
+// deliver pass a message to all handlers of topic concurrently, or only to the handler it's
+// replayed to. It returns an error if a handler neither handled nor dead lettered the message
+func (s *service) deliver(topic string, tp *Topic, data []byte) error {
+	e, err := UnmarshalEnvelope(data)
+	if err != nil {
+		log.Error("unmarshal envelope failed", log.String("topic", topic), log.Err(err))
+		return s.deadLetter(context.Background(), topic, "", &Envelope{Payload: data}, err, 0)
+	}
+	target := e.Headers[replayHeader]
+	if target != "" {
+		// replay header is not passed to handler so it's not propagated to its messages
+		headers := make(map[string]string, len(e.Headers))
+		for k, v := range e.Headers {
+			if k != replayHeader {
+				headers[k] = v
 			}
 		}
-	}()
+		e.Headers = headers
+	}
 
-	go func() {
-		<-ctx.Done()
-		err := ps.Close()
-		log.Error("close subscriber failed", log.String("topic", topic), log.Err(err))
-	}()
+	s.lock.RLock()
+	handlers := tp.handlers
+	s.lock.RUnlock()
+	if target != "" {
+		all := handlers
+		handlers = nil
+		for _, h := range all {
+			if h.name == target {
+				handlers = append(handlers, h)
+			}
+		}
+		if len(handlers) == 0 {
+			// it's dead lettered again so it's not lost and can be replayed where handler is subscribed
+			log.Error("replay handler is not subscribed", log.String("topic", topic), log.String("handler", target))
+			cause := fmt.Errorf("pubsub: replay handler %s is not subscribed", target)
+			return s.deadLetter(context.Background(), topic, target, e, cause, 0)
+		}
+	}
+
+	errs := make(chan error, len(handlers))
+	for _, h := range handlers {
+		go func(h *handler) {
+			if h.ctx.Err() != nil {
+				// unsubscribed after handlers are read
+				errs <- nil
+				return
+			}
+			// each handler has its own copy since envelope is exposed to it by EnvelopeFromContext
+			ec := *e
+			errs <- s.dispatch(h.ctx, topic, h, &ec)
+		}(h)
+	}
+
+	for range handlers {
+		if e := <-errs; e != nil {
+			err = e
+		}
+	}
+	return err
 }
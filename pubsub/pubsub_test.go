@@ -2,11 +2,14 @@ package pubsub
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"testing"
 
+	"github.com/golang-tire/pkg/log"
 	"github.com/golang-tire/pkg/pubsub/test"
+	"github.com/golang/protobuf/proto"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/stretchr/testify/assert"
@@ -27,6 +30,9 @@ func TestMain(m *testing.M) {
 	}
 
 	ctx = context.Background()
+	if err := log.Init(ctx, true); err != nil {
+		panic(err)
+	}
 
 	redisClient = redis.NewClient(&redis.Options{
 		Addr:     fmt.Sprintf("%s:%s", redisServer.Host(), redisServer.Port()),
@@ -46,8 +52,8 @@ func TestNew(t *testing.T) {
 func Test_getOrCreateTopic(t *testing.T) {
 
 	service := &service{
-		redisClient: redisClient,
-		topics:      make(map[string]*Topic),
+		transport: NewRedisTransport(redisClient),
+		topics:    make(map[string]*Topic),
 	}
 
 	// when we dont have the topic already
@@ -72,8 +78,8 @@ func Test_getOrCreateTopic(t *testing.T) {
 
 func TestPubSub(t *testing.T) {
 	service := &service{
-		redisClient: redisClient,
-		topics:      make(map[string]*Topic),
+		transport: NewRedisTransport(redisClient),
+		topics:    make(map[string]*Topic),
 	}
 
 	// should be zero when start
@@ -97,3 +103,58 @@ func TestPubSub(t *testing.T) {
 	<-wait
 	assert.Equal(t, "test-one", receivedData.Name)
 }
+
+func TestSubscribeFunc(t *testing.T) {
+	service := &service{
+		transport: NewRedisTransport(redisClient),
+		topics:    make(map[string]*Topic),
+	}
+
+	_, err := service.SubscribeFunc(ctx, "", nil, nil)
+	assert.NotNil(t, err)
+	_, err = service.SubscribeFunc(ctx, "func-channel", nil, nil)
+	assert.True(t, errors.Is(err, ErrInvalidHandler))
+	_, err = service.SubscribeFunc(ctx, "func-channel", func() proto.Message { return nil }, func(ctx context.Context, msg proto.Message) error {
+		return nil
+	})
+	assert.True(t, errors.Is(err, ErrInvalidHandler))
+
+	var wait = make(chan string, 2)
+	_, err = service.SubscribeFunc(ctx, "func-channel", func() proto.Message { return &test.HelloWorld{} }, func(ctx context.Context, msg proto.Message) error {
+		wait <- msg.(*test.HelloWorld).Name
+		return errors.New("handler failed")
+	})
+	assert.Nil(t, err)
+
+	err = service.Publish(ctx, "func-channel", &test.HelloWorld{Name: "test-func"})
+	assert.Nil(t, err)
+	assert.Equal(t, "test-func", <-wait)
+}
+
+func TestReflectHandler(t *testing.T) {
+	invalid := []Handler{
+		nil,
+		"not a func",
+		func(ctx context.Context) {},
+		func(s string, msg *test.HelloWorld) {},
+		func(ctx context.Context, msg struct{}) {},
+		func(ctx context.Context, msg *string) {},
+		func(ctx context.Context, msg *test.HelloWorld) string { return "" },
+	}
+	for _, h := range invalid {
+		_, _, err := reflectHandler(h)
+		assert.True(t, errors.Is(err, ErrInvalidHandler))
+	}
+
+	newMsg, fn, err := reflectHandler(func(ctx context.Context, msg *test.HelloWorld) error {
+		return fmt.Errorf("got %s", msg.Name)
+	})
+	assert.Nil(t, err)
+	msg := newMsg()
+	msg.(*test.HelloWorld).Name = "x"
+	assert.EqualError(t, fn(ctx, msg), "got x")
+
+	_, fn, err = reflectHandler(func(ctx context.Context, msg *test.HelloWorld) {})
+	assert.Nil(t, err)
+	assert.Nil(t, fn(ctx, &test.HelloWorld{}))
+}
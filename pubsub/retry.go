@@ -0,0 +1,244 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/golang-tire/pkg/log"
+)
+
+// deadLetterSuffix is appended to topic name to get its dead letter topic
+const deadLetterSuffix = ".dlq"
+
+// replayHeader is set on replayed messages to deliver them only to the handler which failed
+const replayHeader = "pubsub-replay-handler"
+
+// RetryPolicy is how failed handler calls are retried, after MaxAttempts the message is
+// published on "<topic>.dlq" topic, see WithDeadLetterTransport
+type RetryPolicy struct {
+	// MaxAttempts is number of handler calls including the first one, default is 3
+	MaxAttempts int
+	// InitialBackoff is wait time before first retry, default is 100 milliseconds
+	InitialBackoff time.Duration
+	// MaxBackoff is max wait time between retries, default is 10 seconds
+	MaxBackoff time.Duration
+	// Multiplier is growth factor of backoff, default is 2
+	Multiplier float64
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = 3
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = 100 * time.Millisecond
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = 10 * time.Second
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = 2
+	}
+	return p
+}
+
+// backoff returns wait time before retry of given attempt, attempts start from 1
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := float64(p.InitialBackoff)
+	for i := 1; i < attempt; i++ {
+		d *= p.Multiplier
+		if d >= float64(p.MaxBackoff) {
+			return p.MaxBackoff
+		}
+	}
+	return time.Duration(d)
+}
+
+// WithRetry returns an Option that set retry policy of failed handler calls
+func WithRetry(p RetryPolicy) Option {
+	return newFuncOption(func(o *serviceOptions) {
+		o.retry = p.withDefaults()
+	})
+}
+
+// DeadLetter is a message which its handler failed after all retries
+type DeadLetter struct {
+	Topic string
+	// Handler is name of the handler which failed, see Subscription.Handler. It's empty if
+	// message could not be decoded before it's passed to handlers
+	Handler   string
+	MessageID string
+	Type      string
+	Headers   map[string]string
+	Payload   []byte
+	Error     string
+	Attempts  int
+	FailedAt  time.Time
+}
+
+// DeadLetterTopic returns dead letter topic of topic
+func DeadLetterTopic(topic string) string {
+	return topic + deadLetterSuffix
+}
+
+// Struct returns dead letter as a structpb.Struct which is published on dead letter topics
+func (d *DeadLetter) Struct() (*structpb.Struct, error) {
+	headers := make(map[string]interface{}, len(d.Headers))
+	for k, v := range d.Headers {
+		headers[k] = v
+	}
+	return structpb.NewStruct(map[string]interface{}{
+		"topic":      d.Topic,
+		"handler":    d.Handler,
+		"message_id": d.MessageID,
+		"type":       d.Type,
+		"headers":    headers,
+		"payload":    base64.StdEncoding.EncodeToString(d.Payload),
+		"error":      d.Error,
+		"attempts":   d.Attempts,
+		"failed_at":  d.FailedAt.Format(time.RFC3339Nano),
+	})
+}
+
+// DecodeDeadLetter decode a message received from a dead letter topic, dead letter topics
+// should be subscribed with a structpb.Struct message factory
+func DecodeDeadLetter(msg *structpb.Struct) (*DeadLetter, error) {
+	fields := msg.GetFields()
+	payload, err := base64.StdEncoding.DecodeString(fields["payload"].GetStringValue())
+	if err != nil {
+		return nil, err
+	}
+	failedAt, err := time.Parse(time.RFC3339Nano, fields["failed_at"].GetStringValue())
+	if err != nil {
+		return nil, err
+	}
+
+	d := &DeadLetter{
+		Topic:     fields["topic"].GetStringValue(),
+		Handler:   fields["handler"].GetStringValue(),
+		MessageID: fields["message_id"].GetStringValue(),
+		Type:      fields["type"].GetStringValue(),
+		Payload:   payload,
+		Error:     fields["error"].GetStringValue(),
+		Attempts:  int(fields["attempts"].GetNumberValue()),
+		FailedAt:  failedAt,
+	}
+	if headers := fields["headers"].GetStructValue().GetFields(); len(headers) > 0 {
+		d.Headers = make(map[string]string, len(headers))
+		for k, v := range headers {
+			d.Headers[k] = v.GetStringValue()
+		}
+	}
+	if d.Topic == "" {
+		return nil, errors.New("pubsub: dead letter has no topic")
+	}
+	return d, nil
+}
+
+// Replay publish a dead letter on its original topic, message keeps its id and headers and
+// it's delivered only to the handler which failed, other handlers of topic do not receive it.
+// If the handler is not subscribed where message is received it's dead lettered again
+func (s *service) Replay(ctx context.Context, d *DeadLetter) error {
+	headers := make(map[string]string, len(d.Headers)+1)
+	for k, v := range d.Headers {
+		headers[k] = v
+	}
+	if d.Handler != "" {
+		headers[replayHeader] = d.Handler
+	}
+	e := &Envelope{
+		ID:          d.MessageID,
+		PublishedAt: time.Now(),
+		ContentType: ContentTypeProtobuf,
+		Type:        d.Type,
+		Headers:     headers,
+		Payload:     d.Payload,
+	}
+	return s.publishRaw(ctx, d.Topic, e.Marshal())
+}
+
+// call run handler and convert its panic to an error
+func call(ctx context.Context, h *handler, msg proto.Message) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error("handler panicked", log.Any("panic", r), log.String("stack", string(debug.Stack())))
+			err = fmt.Errorf("pubsub: handler panicked: %v", r)
+		}
+	}()
+	return h.fn(ctx, msg)
+}
+
+// dispatch decode payload of e and pass it to handler, failed calls are retried based on retry
+// policy and then message is sent to dead letter topic. It returns nil if message is handled or
+// dead lettered, so it can be acknowledged
+func (s *service) dispatch(ctx context.Context, topic string, h *handler, e *Envelope) error {
+	ctx = newEnvelopeContext(ctx, e)
+
+	var (
+		err      error
+		attempts int
+		policy   = s.opts.retry.withDefaults()
+	)
+	for attempts < policy.MaxAttempts {
+		attempts++
+
+		// a fresh message is decoded on each attempt since handler may change it
+		obj := h.newMsg()
+		if err = proto.Unmarshal(e.Payload, obj); err != nil {
+			// a message which can not be decoded never succeeds
+			log.Error("unmarshal data failed", log.String("topic", topic), log.Err(err))
+			break
+		}
+		if err = call(ctx, h, obj); err == nil {
+			return nil
+		}
+		log.Error("handle message failed", log.String("topic", topic), log.Any("attempt", attempts), log.Err(err))
+
+		if attempts < policy.MaxAttempts {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(policy.backoff(attempts)):
+			}
+		}
+	}
+	return s.deadLetter(ctx, topic, h.name, e, err, attempts)
+}
+
+// deadLetter publish a failed message of handler with its error on dead letter topic
+func (s *service) deadLetter(ctx context.Context, topic, handler string, e *Envelope, cause error, attempts int) error {
+	// failures of dead letter handlers are not dead lettered again
+	if strings.HasSuffix(topic, deadLetterSuffix) {
+		log.Error("drop failed dead letter", log.String("topic", topic), log.Err(cause))
+		return nil
+	}
+
+	d := &DeadLetter{
+		Topic:     topic,
+		Handler:   handler,
+		MessageID: e.ID,
+		Type:      e.Type,
+		Headers:   e.Headers,
+		Payload:   e.Payload,
+		Error:     cause.Error(),
+		Attempts:  attempts,
+		FailedAt:  time.Now(),
+	}
+	msg, err := d.Struct()
+	if err != nil {
+		return err
+	}
+	if err := s.Publish(ctx, DeadLetterTopic(topic), msg); err != nil {
+		log.Error("publish dead letter failed", log.String("topic", topic), log.Err(err))
+		return err
+	}
+	return nil
+}
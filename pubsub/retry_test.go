@@ -0,0 +1,312 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/golang-tire/pkg/pubsub/test"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}.withDefaults()
+	assert.Equal(t, 3, p.MaxAttempts)
+	assert.Equal(t, time.Second, p.backoff(1))
+	assert.Equal(t, 2*time.Second, p.backoff(2))
+	assert.Equal(t, 4*time.Second, p.backoff(3))
+	assert.Equal(t, 5*time.Second, p.backoff(4))
+}
+
+func TestRetryPanic(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	service := New(redisClient, WithRetry(RetryPolicy{InitialBackoff: time.Millisecond}))
+	var calls int32
+	received := make(chan string, 1)
+	_, err := service.SubscribeFunc(ctx, "panic-topic", helloFactory, func(ctx context.Context, msg proto.Message) error {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			panic("boom")
+		}
+		received <- msg.(*test.HelloWorld).Name
+		return nil
+	})
+	assert.Nil(t, err)
+	time.Sleep(50 * time.Millisecond)
+
+	assert.Nil(t, service.Publish(ctx, "panic-topic", &test.HelloWorld{Name: "again"}))
+	select {
+	case got := <-received:
+		assert.Equal(t, "again", got)
+	case <-time.After(time.Second):
+		t.Fatal("message is not retried")
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestDeadLetter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// topic is unique per run since dead letters are kept on a stream of shared miniredis
+	topic := "dlq-topic-" + uuid.New().String()
+	service := New(redisClient, WithRetry(RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}))
+	var (
+		calls int32
+		fail  int32 = 1
+	)
+	received := make(chan string, 1)
+	_, err := service.SubscribeFunc(ctx, topic, helloFactory, func(ctx context.Context, msg proto.Message) error {
+		atomic.AddInt32(&calls, 1)
+		if atomic.LoadInt32(&fail) == 1 {
+			return errors.New("failed")
+		}
+		received <- msg.(*test.HelloWorld).Name
+		return nil
+	})
+	assert.Nil(t, err)
+
+	letters := make(chan *DeadLetter, 1)
+	_, err = service.SubscribeFunc(ctx, DeadLetterTopic(topic), func() proto.Message {
+		return &structpb.Struct{}
+	}, func(ctx context.Context, msg proto.Message) error {
+		d, err := DecodeDeadLetter(msg.(*structpb.Struct))
+		if err != nil {
+			return err
+		}
+		letters <- d
+		return nil
+	})
+	assert.Nil(t, err)
+	time.Sleep(50 * time.Millisecond)
+
+	assert.Nil(t, service.Publish(ctx, topic, &test.HelloWorld{Name: "poison"}))
+	var d *DeadLetter
+	select {
+	case d = <-letters:
+	case <-time.After(time.Second):
+		t.Fatal("dead letter is not received")
+	}
+	assert.Equal(t, topic, d.Topic)
+	assert.Equal(t, "failed", d.Error)
+	assert.Equal(t, 2, d.Attempts)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	assert.WithinDuration(t, time.Now(), d.FailedAt, time.Second)
+
+	// replay after handler is fixed
+	atomic.StoreInt32(&fail, 0)
+	assert.Nil(t, service.Replay(ctx, d))
+	select {
+	case got := <-received:
+		assert.Equal(t, "poison", got)
+	case <-time.After(time.Second):
+		t.Fatal("replayed message is not received")
+	}
+}
+
+func TestDeadLetterDurable(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	topic := "durable-dlq-topic-" + uuid.New().String()
+	service := New(redisClient, WithRetry(RetryPolicy{MaxAttempts: 1}))
+	_, err := service.SubscribeFunc(ctx, topic, helloFactory, func(ctx context.Context, msg proto.Message) error {
+		return errors.New("failed")
+	})
+	assert.Nil(t, err)
+	time.Sleep(50 * time.Millisecond)
+	assert.Nil(t, service.Publish(ctx, topic, &test.HelloWorld{Name: "poison"}))
+
+	// dead letter is not lost when nothing is subscribed to dead letter topic
+	time.Sleep(100 * time.Millisecond)
+	letters := make(chan *DeadLetter, 1)
+	_, err = service.SubscribeFunc(ctx, DeadLetterTopic(topic), func() proto.Message {
+		return &structpb.Struct{}
+	}, func(ctx context.Context, msg proto.Message) error {
+		d, err := DecodeDeadLetter(msg.(*structpb.Struct))
+		if err != nil {
+			return err
+		}
+		letters <- d
+		return nil
+	})
+	assert.Nil(t, err)
+	select {
+	case d := <-letters:
+		assert.Equal(t, topic, d.Topic)
+		assert.Equal(t, 1, d.Attempts)
+	case <-time.After(time.Second):
+		t.Fatal("dead letter is not received")
+	}
+}
+
+func TestStreamDeadLetter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg := StreamConfig{Group: "dead-letter", Consumer: "c1", Block: 50 * time.Millisecond}
+	service := New(redisClient,
+		WithStream("stream-dlq-topic", cfg),
+		WithStream(DeadLetterTopic("stream-dlq-topic"), cfg),
+		WithRetry(RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}),
+	)
+	_, err := service.SubscribeFunc(ctx, "stream-dlq-topic", helloFactory, func(ctx context.Context, msg proto.Message) error {
+		return errors.New("failed")
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, service.Publish(ctx, "stream-dlq-topic", &test.HelloWorld{Name: "poison"}))
+
+	// dead letter is kept on its stream until someone subscribes
+	time.Sleep(200 * time.Millisecond)
+	letters := make(chan *DeadLetter, 1)
+	_, err = service.SubscribeFunc(ctx, DeadLetterTopic("stream-dlq-topic"), func() proto.Message {
+		return &structpb.Struct{}
+	}, func(ctx context.Context, msg proto.Message) error {
+		d, err := DecodeDeadLetter(msg.(*structpb.Struct))
+		if err != nil {
+			return err
+		}
+		letters <- d
+		return nil
+	})
+	assert.Nil(t, err)
+	select {
+	case d := <-letters:
+		assert.Equal(t, "stream-dlq-topic", d.Topic)
+		assert.Equal(t, 2, d.Attempts)
+		msg := &test.HelloWorld{}
+		assert.Nil(t, proto.Unmarshal(d.Payload, msg))
+		assert.Equal(t, "poison", msg.Name)
+	case <-time.After(time.Second):
+		t.Fatal("dead letter is not received")
+	}
+
+	// failed message is acknowledged once it's dead lettered
+	pending, err := redisClient.XPending(ctx, "stream-dlq-topic", "dead-letter").Result()
+	if err == nil {
+		assert.Equal(t, int64(0), pending.Count)
+	}
+}
+
+func TestReplayToHandler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	service := NewWithTransport(NewMemoryTransport(), WithRetry(RetryPolicy{MaxAttempts: 1}))
+	ch := make(chan received, 4)
+	var fail int32 = 1
+	_, err := service.SubscribeFunc(ctx, "replay-topic", helloFactory, collect("ok", ch))
+	assert.Nil(t, err)
+	failing, err := service.SubscribeFunc(ctx, "replay-topic", helloFactory, func(ctx context.Context, msg proto.Message) error {
+		if atomic.LoadInt32(&fail) == 1 {
+			return errors.New("failed")
+		}
+		ch <- received{name: "fixed", msg: msg}
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.NotEqual(t, "", failing.Handler())
+
+	// the same function is numbered on its topic
+	second, err := service.SubscribeFunc(ctx, "numbered-topic", helloFactory, collect("a", ch))
+	assert.Nil(t, err)
+	third, err := service.SubscribeFunc(ctx, "numbered-topic", helloFactory, collect("b", ch))
+	assert.Nil(t, err)
+	assert.Equal(t, second.Handler()+"#2", third.Handler())
+
+	letters := make(chan *DeadLetter, 2)
+	_, err = service.SubscribeFunc(ctx, DeadLetterTopic("replay-topic"), func() proto.Message {
+		return &structpb.Struct{}
+	}, func(ctx context.Context, msg proto.Message) error {
+		d, err := DecodeDeadLetter(msg.(*structpb.Struct))
+		if err != nil {
+			return err
+		}
+		letters <- d
+		return nil
+	})
+	assert.Nil(t, err)
+
+	assert.Nil(t, service.Publish(ctx, "replay-topic", &test.HelloWorld{Name: "poison"}))
+	var d *DeadLetter
+	select {
+	case d = <-letters:
+	case <-time.After(time.Second):
+		t.Fatal("dead letter is not received")
+	}
+	assert.Equal(t, failing.Handler(), d.Handler)
+	assert.Equal(t, "ok", (<-ch).name)
+
+	// replayed message is delivered only to the handler which failed
+	atomic.StoreInt32(&fail, 0)
+	assert.Nil(t, service.Replay(ctx, d))
+	select {
+	case r := <-ch:
+		assert.Equal(t, "fixed", r.name)
+		assert.Equal(t, "poison", r.msg.(*test.HelloWorld).Name)
+	case <-time.After(time.Second):
+		t.Fatal("replayed message is not received")
+	}
+	select {
+	case r := <-ch:
+		t.Fatalf("replayed message is received by %s", r.name)
+	case d := <-letters:
+		t.Fatalf("replayed message is dead lettered by %s", d.Handler)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestReplayToUnknownHandler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	service := NewWithTransport(NewMemoryTransport())
+	ch := make(chan received, 1)
+	_, err := service.SubscribeFunc(ctx, "unknown-replay-topic", helloFactory, collect("other", ch))
+	assert.Nil(t, err)
+	letters := make(chan *DeadLetter, 1)
+	_, err = service.SubscribeFunc(ctx, DeadLetterTopic("unknown-replay-topic"), func() proto.Message {
+		return &structpb.Struct{}
+	}, func(ctx context.Context, msg proto.Message) error {
+		d, err := DecodeDeadLetter(msg.(*structpb.Struct))
+		if err != nil {
+			return err
+		}
+		letters <- d
+		return nil
+	})
+	assert.Nil(t, err)
+
+	payload, err := proto.Marshal(&test.HelloWorld{Name: "lost"})
+	assert.Nil(t, err)
+	assert.Nil(t, service.Replay(ctx, &DeadLetter{
+		Topic:     "unknown-replay-topic",
+		Handler:   "gone",
+		MessageID: "m1",
+		Type:      "test.HelloWorld",
+		Payload:   payload,
+	}))
+
+	// message is dead lettered again for the same handler instead of being dropped
+	select {
+	case d := <-letters:
+		assert.Equal(t, "gone", d.Handler)
+		assert.Equal(t, "m1", d.MessageID)
+		assert.Equal(t, payload, d.Payload)
+		assert.Contains(t, d.Error, "not subscribed")
+	case <-time.After(time.Second):
+		t.Fatal("dead letter is not received")
+	}
+	select {
+	case r := <-ch:
+		t.Fatalf("replayed message is received by %s", r.name)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
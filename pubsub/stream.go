@@ -0,0 +1,309 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/golang-tire/pkg/log"
+)
+
+// dataField is the stream entry field which holds encoded message
+const dataField = "data"
+
+// StreamConfig is configuration of a topic backed by a redis stream, messages are kept in
+// stream until they are acknowledged so they survive restarts of subscribers
+type StreamConfig struct {
+	// Group is the consumer group, instances of a service should use the same group
+	// to share messages and different services should use different groups, default is "pubsub"
+	Group string
+	// Consumer is name of this consumer in group, it should be stable across restarts to
+	// receive its pending messages again, default is hostname-pid
+	Consumer string
+	// MaxLen is approximate max length of stream, zero means unlimited
+	MaxLen int64
+	// MinIdle is how long a message should stay unacknowledged before it's reclaimed
+	// from a crashed consumer, default is 1 minute
+	MinIdle time.Duration
+	// ClaimInterval is interval of checking pending messages of other consumers, default is 30 seconds
+	ClaimInterval time.Duration
+	// Block is how long a read waits for new messages, default is 2 seconds
+	Block time.Duration
+	// Count is max number of messages of a read, default is 10
+	Count int64
+}
+
+func (c StreamConfig) withDefaults() StreamConfig {
+	if c.Group == "" {
+		c.Group = "pubsub"
+	}
+	if c.Consumer == "" {
+		host, _ := os.Hostname()
+		c.Consumer = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	if c.MinIdle <= 0 {
+		c.MinIdle = time.Minute
+	}
+	if c.ClaimInterval <= 0 {
+		c.ClaimInterval = 30 * time.Second
+	}
+	if c.Block <= 0 {
+		c.Block = 2 * time.Second
+	}
+	if c.Count <= 0 {
+		c.Count = 10
+	}
+	return c
+}
+
+// WithStream returns an Option that publish messages of topic on a redis stream with the same
+// name and consume them using a consumer group, it's used by New which has the redis client.
+// Messages are acknowledged when all handlers of topic handle them or they are dead lettered,
+// otherwise they are delivered again after cfg.MinIdle
+func WithStream(topic string, cfg StreamConfig) Option {
+	return newFuncOption(func(o *serviceOptions) {
+		o.streams[topic] = cfg.withDefaults()
+	})
+}
+
+// streamTransport use redis streams and consumer groups, messages are kept until they are acknowledged
+type streamTransport struct {
+	client *redis.Client
+	cfg    StreamConfig
+}
+
+// NewStreamTransport returns a Transport which use redis streams, each topic is a stream with the same name
+func NewStreamTransport(client *redis.Client, cfg StreamConfig) Transport {
+	return &streamTransport{client: client, cfg: cfg.withDefaults()}
+}
+
+func (t *streamTransport) Publish(ctx context.Context, topic string, data []byte) error {
+	return t.client.XAdd(ctx, &redis.XAddArgs{
+		Stream:       topic,
+		MaxLenApprox: t.cfg.MaxLen,
+		Values:       map[string]interface{}{dataField: data},
+	}).Err()
+}
+
+// Subscribe create consumer group of topic and start reading and reclaiming its messages until ctx is done
+func (t *streamTransport) Subscribe(ctx context.Context, topic string, fn DeliverFunc) error {
+	// group starts from the beginning so messages published before first subscriber are not lost
+	err := t.client.XGroupCreate(ctx, topic, t.cfg.Group, "0").Err()
+	if err != nil && !strings.Contains(err.Error(), "BUSYGROUP") {
+		// stream does not exist yet
+		err = t.client.XGroupCreateMkStream(ctx, topic, t.cfg.Group, "0").Err()
+	}
+	if err != nil && !strings.Contains(err.Error(), "BUSYGROUP") {
+		return err
+	}
+
+	go t.readStream(ctx, topic, fn)
+	go func() {
+		ticker := time.NewTicker(t.cfg.ClaimInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := t.reclaim(ctx, topic, fn); err != nil && ctx.Err() == nil {
+					log.Error("reclaim pending messages failed", log.String("topic", topic), log.Err(err))
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// readStream read messages of consumer group, it first reads messages which are delivered to
+// this consumer but not acknowledged e.g. before a restart and then new messages
+func (t *streamTransport) readStream(ctx context.Context, topic string, fn DeliverFunc) {
+	start := "0"
+	for ctx.Err() == nil {
+		id := ">"
+		if start != "" {
+			id = start
+		}
+
+		res, err := t.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    t.cfg.Group,
+			Consumer: t.cfg.Consumer,
+			Streams:  []string{topic, id},
+			Count:    t.cfg.Count,
+			Block:    t.cfg.Block,
+		}).Result()
+		if err == redis.Nil {
+			// read timed out or there is no pending message
+			start = ""
+			continue
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Error("read stream failed", log.String("topic", topic), log.Err(err))
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+
+		var msgs []redis.XMessage
+		if len(res) > 0 {
+			msgs = res[0].Messages
+		}
+		if start != "" {
+			if len(msgs) == 0 {
+				// all pending messages are handled, switch to new messages
+				start = ""
+				continue
+			}
+			start = msgs[len(msgs)-1].ID
+		}
+
+		for _, msg := range msgs {
+			t.handleStreamMessage(ctx, topic, fn, msg)
+		}
+	}
+}
+
+// handleStreamMessage deliver message and acknowledge it if it's handled
+func (t *streamTransport) handleStreamMessage(ctx context.Context, topic string, fn DeliverFunc, msg redis.XMessage) {
+	data, ok := msg.Values[dataField].(string)
+	if !ok {
+		// entries trimmed by MaxLen or deleted while pending are returned with nil fields,
+		// they have nothing to deliver so they are only acknowledged
+		log.Error("skip stream entry without data", log.String("topic", topic), log.String("id", msg.ID))
+		if err := t.client.XAck(ctx, topic, t.cfg.Group, msg.ID).Err(); err != nil {
+			log.Error("ack message failed", log.String("topic", topic), log.String("id", msg.ID), log.Err(err))
+		}
+		return
+	}
+	if err := fn(ctx, []byte(data)); err != nil {
+		// message stays pending and is delivered again
+		return
+	}
+	if err := t.client.XAck(ctx, topic, t.cfg.Group, msg.ID).Err(); err != nil {
+		log.Error("ack message failed", log.String("topic", topic), log.String("id", msg.ID), log.Err(err))
+	}
+}
+
+// reclaim take over messages pending on other consumers for more than cfg.MinIdle and handle them
+func (t *streamTransport) reclaim(ctx context.Context, topic string, fn DeliverFunc) error {
+	start := "0-0"
+	for {
+		msgs, next, err := t.autoClaim(ctx, topic, start)
+		if err != nil && strings.Contains(strings.ToLower(err.Error()), "unknown command") {
+			msgs, next, err = t.claimPending(ctx, topic, start)
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, msg := range msgs {
+			t.handleStreamMessage(ctx, topic, fn, msg)
+		}
+		if next == "0-0" || next == "" || ctx.Err() != nil {
+			return nil
+		}
+		start = next
+	}
+}
+
+// autoClaim run XAUTOCLAIM which is available since redis 6.2
+func (t *streamTransport) autoClaim(ctx context.Context, topic, start string) ([]redis.XMessage, string, error) {
+	v, err := t.client.Do(ctx, "xautoclaim", topic, t.cfg.Group, t.cfg.Consumer,
+		t.cfg.MinIdle.Milliseconds(), start, "count", t.cfg.Count).Result()
+	if err != nil {
+		return nil, "", err
+	}
+	return parseAutoClaim(v)
+}
+
+// parseAutoClaim parse reply of XAUTOCLAIM, which is next start id and claimed messages,
+// redis 7 also returns deleted ids which are ignored
+func parseAutoClaim(v interface{}) ([]redis.XMessage, string, error) {
+	reply, ok := v.([]interface{})
+	if !ok || len(reply) < 2 {
+		return nil, "", fmt.Errorf("pubsub: unexpected xautoclaim reply %v", v)
+	}
+	next, _ := reply[0].(string)
+	entries, _ := reply[1].([]interface{})
+
+	msgs := make([]redis.XMessage, 0, len(entries))
+	for _, e := range entries {
+		entry, ok := e.([]interface{})
+		if !ok || len(entry) != 2 {
+			continue
+		}
+		id, _ := entry[0].(string)
+		// entries deleted from stream have nil fields
+		fields, _ := entry[1].([]interface{})
+		values := make(map[string]interface{}, len(fields)/2)
+		for i := 0; i+1 < len(fields); i += 2 {
+			k, _ := fields[i].(string)
+			values[k] = fields[i+1]
+		}
+		msgs = append(msgs, redis.XMessage{ID: id, Values: values})
+	}
+	return msgs, next, nil
+}
+
+// claimPending claim idle messages using XPENDING and XCLAIM on redis versions without XAUTOCLAIM
+func (t *streamTransport) claimPending(ctx context.Context, topic, start string) ([]redis.XMessage, string, error) {
+	if start == "0-0" {
+		start = "-"
+	}
+	pending, err := t.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: topic,
+		Group:  t.cfg.Group,
+		Start:  start,
+		End:    "+",
+		Count:  t.cfg.Count,
+	}).Result()
+	if err != nil {
+		return nil, "", err
+	}
+	if len(pending) == 0 {
+		return nil, "0-0", nil
+	}
+
+	var ids []string
+	for _, p := range pending {
+		if p.Idle >= t.cfg.MinIdle {
+			ids = append(ids, p.ID)
+		}
+	}
+
+	next := "0-0"
+	if int64(len(pending)) == t.cfg.Count {
+		next = nextID(pending[len(pending)-1].ID)
+	}
+	if len(ids) == 0 {
+		return nil, next, nil
+	}
+
+	msgs, err := t.client.XClaim(ctx, &redis.XClaimArgs{
+		Stream:   topic,
+		Group:    t.cfg.Group,
+		Consumer: t.cfg.Consumer,
+		MinIdle:  t.cfg.MinIdle,
+		Messages: ids,
+	}).Result()
+	return msgs, next, err
+}
+
+// nextID returns the smallest stream id greater than id, exclusive ranges need redis 6.2
+func nextID(id string) string {
+	var ms, seq uint64
+	if _, err := fmt.Sscanf(id, "%d-%d", &ms, &seq); err != nil {
+		return "0-0"
+	}
+	return fmt.Sprintf("%d-%d", ms, seq+1)
+}
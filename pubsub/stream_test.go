@@ -0,0 +1,165 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/golang/protobuf/proto"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/golang-tire/pkg/pubsub/test"
+)
+
+func helloFactory() proto.Message {
+	return &test.HelloWorld{}
+}
+
+func TestStreamDurable(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg := StreamConfig{Consumer: "c1", Block: 50 * time.Millisecond}
+	service := New(redisClient, WithStream("durable-topic", cfg))
+
+	// published before any subscriber
+	assert.Nil(t, service.Publish(ctx, "durable-topic", &test.HelloWorld{Name: "early"}))
+
+	received := make(chan string, 2)
+	_, err := service.SubscribeFunc(ctx, "durable-topic", helloFactory, func(ctx context.Context, msg proto.Message) error {
+		received <- msg.(*test.HelloWorld).Name
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, service.Publish(ctx, "durable-topic", &test.HelloWorld{Name: "late"}))
+
+	for _, name := range []string{"early", "late"} {
+		select {
+		case got := <-received:
+			assert.Equal(t, name, got)
+		case <-time.After(time.Second):
+			t.Fatal("message is not received")
+		}
+	}
+}
+
+func TestStreamRedelivery(t *testing.T) {
+	cfg := StreamConfig{Group: "redelivery", Consumer: "c1", Block: 50 * time.Millisecond}
+
+	// consumer fails and goes away before acknowledging
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	failed := make(chan bool, 1)
+	service := New(redisClient, WithStream("redelivery-topic", cfg))
+	_, err := service.SubscribeFunc(ctx1, "redelivery-topic", helloFactory, func(ctx context.Context, msg proto.Message) error {
+		failed <- true
+		return errors.New("failed")
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, service.Publish(ctx1, "redelivery-topic", &test.HelloWorld{Name: "retry"}))
+	select {
+	case <-failed:
+	case <-time.After(time.Second):
+		t.Fatal("message is not received")
+	}
+	cancel1()
+	time.Sleep(100 * time.Millisecond)
+
+	// restarted consumer receives its pending message again
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel2()
+	received := make(chan string, 1)
+	service = New(redisClient, WithStream("redelivery-topic", cfg))
+	_, err = service.SubscribeFunc(ctx2, "redelivery-topic", helloFactory, func(ctx context.Context, msg proto.Message) error {
+		received <- msg.(*test.HelloWorld).Name
+		return nil
+	})
+	assert.Nil(t, err)
+	select {
+	case got := <-received:
+		assert.Equal(t, "retry", got)
+	case <-time.After(time.Second):
+		t.Fatal("pending message is not delivered again")
+	}
+
+	assert.Eventually(t, func() bool {
+		res, err := redisClient.XReadGroup(context.Background(), &redis.XReadGroupArgs{
+			Group: "redelivery", Consumer: "c1", Streams: []string{"redelivery-topic", "0"}, Block: -1,
+		}).Result()
+		// redis returns an empty stream and miniredis returns nil when nothing is pending
+		return err == redis.Nil || (err == nil && len(res) == 1 && len(res[0].Messages) == 0)
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestStreamMaxLen(t *testing.T) {
+	service := New(redisClient, WithStream("capped-topic", StreamConfig{MaxLen: 5}))
+	for i := 0; i < 20; i++ {
+		assert.Nil(t, service.Publish(ctx, "capped-topic", &test.HelloWorld{Name: "x"}))
+	}
+	n, err := redisClient.XLen(ctx, "capped-topic").Result()
+	assert.Nil(t, err)
+	assert.LessOrEqual(t, n, int64(20))
+	assert.Greater(t, n, int64(0))
+}
+
+func TestParseAutoClaim(t *testing.T) {
+	reply := []interface{}{
+		"1-5",
+		[]interface{}{
+			[]interface{}{"1-1", []interface{}{"data", "abc"}},
+			[]interface{}{"1-2", nil},
+		},
+		[]interface{}{},
+	}
+	msgs, next, err := parseAutoClaim(reply)
+	assert.Nil(t, err)
+	assert.Equal(t, "1-5", next)
+	assert.Len(t, msgs, 2)
+	assert.Equal(t, "1-1", msgs[0].ID)
+	assert.Equal(t, "abc", msgs[0].Values["data"])
+	assert.Empty(t, msgs[1].Values)
+
+	_, _, err = parseAutoClaim("bad")
+	assert.NotNil(t, err)
+	assert.Equal(t, "1-6", nextID("1-5"))
+}
+
+func TestStreamTrimmedEntry(t *testing.T) {
+	topic := "trimmed-topic-" + uuid.New().String()
+	tr := NewStreamTransport(redisClient, StreamConfig{Group: "trimmed", Consumer: "c1"}).(*streamTransport)
+	assert.Nil(t, redisClient.XGroupCreateMkStream(ctx, topic, "trimmed", "0").Err())
+	assert.Nil(t, tr.Publish(ctx, topic, []byte("payload")))
+	res, err := redisClient.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    "trimmed",
+		Consumer: "c1",
+		Streams:  []string{topic, ">"},
+	}).Result()
+	assert.Nil(t, err)
+	id := res[0].Messages[0].ID
+
+	// pending entry is removed like MaxLen trimming does, redis redeliver it with nil fields
+	// but miniredis has no XTRIM and skips such entries so reply of redis is used
+	assert.Nil(t, redisClient.XDel(ctx, topic, id).Err())
+	msgs, _, err := parseAutoClaim([]interface{}{"0-0", []interface{}{[]interface{}{id, nil}}})
+	assert.Nil(t, err)
+
+	calls := 0
+	fn := func(ctx context.Context, data []byte) error {
+		calls++
+		return nil
+	}
+	tr.handleStreamMessage(ctx, topic, fn, msgs[0])
+	tr.handleStreamMessage(ctx, topic, fn, redis.XMessage{ID: id})
+	tr.handleStreamMessage(ctx, topic, fn, redis.XMessage{ID: id, Values: map[string]interface{}{dataField: nil}})
+	assert.Equal(t, 0, calls)
+
+	// and nothing stays pending
+	res, err = redisClient.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    "trimmed",
+		Consumer: "c1",
+		Streams:  []string{topic, "0"},
+	}).Result()
+	assert.True(t, err == redis.Nil || (err == nil && len(res[0].Messages) == 0))
+}
@@ -0,0 +1,36 @@
+package pubsub
+
+import "context"
+
+// Subscription is a handler subscribed on a topic
+type Subscription struct {
+	topic   string
+	handler string
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+// Topic returns topic of subscription
+func (s *Subscription) Topic() string {
+	return s.topic
+}
+
+// Handler returns name of handler in its topic, it's name of handler function and it's
+// suffixed with "#2", "#3", ... when the same function is subscribed again on topic. It's
+// stable across restarts as long as handlers are subscribed in the same order
+func (s *Subscription) Handler() string {
+	return s.handler
+}
+
+// Unsubscribe stop delivering messages to handler, it returns after handler is removed but
+// calls which are in progress may still be running
+func (s *Subscription) Unsubscribe() {
+	s.cancel()
+	<-s.done
+}
+
+// Done returns a channel which is closed when handler is unsubscribed, either by Unsubscribe
+// or when context of subscription is done
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
@@ -0,0 +1,120 @@
+package pubsub
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/golang-tire/pkg/pubsub/test"
+)
+
+type received struct {
+	name string
+	msg  proto.Message
+}
+
+func collect(name string, ch chan received) HandlerFunc {
+	return func(ctx context.Context, msg proto.Message) error {
+		ch <- received{name: name, msg: msg}
+		return nil
+	}
+}
+
+func numSub(t *testing.T, topic string) int64 {
+	num, err := redisClient.PubSubNumSub(context.Background(), topic).Result()
+	assert.Nil(t, err)
+	return num[topic]
+}
+
+func TestFanOut(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	service := New(redisClient)
+	ch := make(chan received, 4)
+	_, err := service.SubscribeFunc(ctx, "fan-out-topic", helloFactory, collect("a", ch))
+	assert.Nil(t, err)
+	_, err = service.SubscribeFunc(ctx, "fan-out-topic", helloFactory, collect("b", ch))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), numSub(t, "fan-out-topic"))
+
+	assert.Nil(t, service.Publish(ctx, "fan-out-topic", &test.HelloWorld{Name: "once"}))
+	got := make(map[string]proto.Message)
+	for i := 0; i < 2; i++ {
+		select {
+		case r := <-ch:
+			got[r.name] = r.msg
+		case <-time.After(time.Second):
+			t.Fatal("message is not received")
+		}
+	}
+	select {
+	case r := <-ch:
+		t.Fatalf("message is received twice by %s", r.name)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// each handler has its own copy of message
+	assert.Len(t, got, 2)
+	assert.True(t, got["a"] != got["b"])
+}
+
+func TestUnsubscribe(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	service := New(redisClient)
+	ch := make(chan received, 4)
+	subA, err := service.SubscribeFunc(ctx, "unsubscribe-topic", helloFactory, collect("a", ch))
+	assert.Nil(t, err)
+	assert.Equal(t, "unsubscribe-topic", subA.Topic())
+
+	ctxB, cancelB := context.WithCancel(ctx)
+	subB, err := service.SubscribeFunc(ctxB, "unsubscribe-topic", helloFactory, collect("b", ch))
+	assert.Nil(t, err)
+
+	// a handler is unsubscribed when its context is done, others keep receiving
+	cancelB()
+	select {
+	case <-subB.Done():
+	case <-time.After(time.Second):
+		t.Fatal("subscription is not done")
+	}
+	assert.Nil(t, service.Publish(ctx, "unsubscribe-topic", &test.HelloWorld{Name: "a-only"}))
+	select {
+	case r := <-ch:
+		assert.Equal(t, "a", r.name)
+	case <-time.After(time.Second):
+		t.Fatal("message is not received")
+	}
+	select {
+	case r := <-ch:
+		t.Fatalf("unexpected message for %s", r.name)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// transport subscription is closed with the last handler
+	subA.Unsubscribe()
+	select {
+	case <-subA.Done():
+	default:
+		t.Fatal("subscription is not done")
+	}
+	subA.Unsubscribe()
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int64(0), numSub(t, "unsubscribe-topic"))
+
+	// and topic can be subscribed again
+	_, err = service.SubscribeFunc(ctx, "unsubscribe-topic", helloFactory, collect("c", ch))
+	assert.Nil(t, err)
+	assert.Nil(t, service.Publish(ctx, "unsubscribe-topic", &test.HelloWorld{Name: "again"}))
+	select {
+	case r := <-ch:
+		assert.Equal(t, "c", r.name)
+	case <-time.After(time.Second):
+		t.Fatal("message is not received")
+	}
+}
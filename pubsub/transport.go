@@ -0,0 +1,139 @@
+package pubsub
+
+import (
+	"context"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/golang-tire/pkg/log"
+)
+
+// DeliverFunc handle an encoded message received by a transport, transports which support
+// acknowledgements deliver the message again if it returns an error
+type DeliverFunc func(ctx context.Context, data []byte) error
+
+// Transport send and receive encoded messages of topics, it's used by Service which does
+// encoding, retries and dead letters
+type Transport interface {
+	// Publish send data to topic
+	Publish(ctx context.Context, topic string, data []byte) error
+	// Subscribe start delivering messages of topic to fn until ctx is done
+	Subscribe(ctx context.Context, topic string, fn DeliverFunc) error
+}
+
+// redisTransport use redis PUBLISH and SUBSCRIBE, messages are lost if there is no subscriber
+type redisTransport struct {
+	client *redis.Client
+}
+
+// NewRedisTransport returns a Transport which use redis pub/sub
+func NewRedisTransport(client *redis.Client) Transport {
+	return &redisTransport{client: client}
+}
+
+func (t *redisTransport) Publish(ctx context.Context, topic string, data []byte) error {
+	return t.client.Publish(ctx, topic, data).Err()
+}
+
+func (t *redisTransport) Subscribe(ctx context.Context, topic string, fn DeliverFunc) error {
+	ps := t.client.Subscribe(ctx, topic)
+	// wait for confirmation so messages published after Subscribe returns are received
+	if _, err := ps.Receive(ctx); err != nil {
+		_ = ps.Close()
+		return err
+	}
+
+	go func() {
+		for msg := range ps.Channel() {
+			if msg.Channel == topic {
+				go func(data []byte) {
+					_ = fn(ctx, data)
+				}([]byte(msg.Payload))
+			}
+		}
+	}()
+
+	go func() {
+		<-ctx.Done()
+		if err := ps.Close(); err != nil {
+			log.Error("close subscriber failed", log.String("topic", topic), log.Err(err))
+		}
+	}()
+	return nil
+}
+
+// memoryBufferSize is number of messages queued for each subscriber of memory transport
+const memoryBufferSize = 100
+
+// memoryTransport is an in-process bus, it can be used in unit tests and single binary deployments
+type memoryTransport struct {
+	lock sync.RWMutex
+	subs map[string][]*memorySubscriber
+}
+
+type memorySubscriber struct {
+	ch   chan []byte
+	done <-chan struct{}
+}
+
+// NewMemoryTransport returns a Transport which deliver messages in process using channels
+func NewMemoryTransport() Transport {
+	return &memoryTransport{subs: make(map[string][]*memorySubscriber)}
+}
+
+func (t *memoryTransport) Publish(ctx context.Context, topic string, data []byte) error {
+	t.lock.RLock()
+	subs := t.subs[topic]
+	t.lock.RUnlock()
+
+	for _, sub := range subs {
+		select {
+		case sub.ch <- data:
+		case <-sub.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (t *memoryTransport) Subscribe(ctx context.Context, topic string, fn DeliverFunc) error {
+	sub := &memorySubscriber{ch: make(chan []byte, memoryBufferSize), done: ctx.Done()}
+
+	t.lock.Lock()
+	t.subs[topic] = append(t.subs[topic], sub)
+	t.lock.Unlock()
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				t.remove(topic, sub)
+				return
+			case data := <-sub.ch:
+				go func() {
+					_ = fn(ctx, data)
+				}()
+			}
+		}
+	}()
+	return nil
+}
+
+func (t *memoryTransport) remove(topic string, sub *memorySubscriber) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	subs := t.subs[topic]
+	for i := range subs {
+		if subs[i] == sub {
+			// a new slice is built since publishers may iterate the old one
+			t.subs[topic] = append(append([]*memorySubscriber(nil), subs[:i]...), subs[i+1:]...)
+			break
+		}
+	}
+	if len(t.subs[topic]) == 0 {
+		delete(t.subs, topic)
+	}
+}
@@ -0,0 +1,185 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	natsserver "github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/golang-tire/pkg/pubsub/test"
+)
+
+// testTransport run a pubsub service over tr and check delivery of messages
+func testTransport(t *testing.T, tr Transport, topic string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	service := NewWithTransport(tr)
+	received := make(chan *test.HelloWorld, 1)
+	_, err := service.SubscribeFunc(ctx, topic, helloFactory, func(ctx context.Context, msg proto.Message) error {
+		assert.Equal(t, "c1", HeaderFromContext(ctx, "correlation-id"))
+		received <- msg.(*test.HelloWorld)
+		return nil
+	})
+	assert.Nil(t, err)
+
+	// one message per topic is published since miniredis can not read more entries of a stream
+	// after some of them are consumed
+	pubCtx := WithHeader(ctx, "correlation-id", "c1")
+	assert.Nil(t, service.Publish(pubCtx, topic, &test.HelloWorld{Name: "hello"}))
+	select {
+	case msg := <-received:
+		assert.Equal(t, "hello", msg.Name)
+	case <-time.After(time.Second):
+		t.Fatal("message is not received")
+	}
+
+	// other topics are not delivered
+	assert.Nil(t, service.Publish(ctx, topic+"-other", &test.HelloWorld{Name: "other"}))
+	select {
+	case msg := <-received:
+		t.Fatalf("unexpected message %s", msg.Name)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestMemoryTransport(t *testing.T) {
+	testTransport(t, NewMemoryTransport(), "memory-topic")
+
+	// subscribers are removed when their context is done
+	tr := NewMemoryTransport().(*memoryTransport)
+	ctx, cancel := context.WithCancel(context.Background())
+	assert.Nil(t, tr.Subscribe(ctx, "memory-topic", func(ctx context.Context, data []byte) error {
+		return nil
+	}))
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	tr.lock.RLock()
+	assert.Empty(t, tr.subs)
+	tr.lock.RUnlock()
+	assert.Nil(t, tr.Publish(context.Background(), "memory-topic", []byte("data")))
+}
+
+func TestRedisTransport(t *testing.T) {
+	testTransport(t, NewRedisTransport(redisClient), "redis-transport-topic")
+}
+
+func TestStreamTransport(t *testing.T) {
+	cfg := StreamConfig{Group: "transport", Consumer: "c1", Block: 50 * time.Millisecond}
+	testTransport(t, NewStreamTransport(redisClient, cfg), "stream-transport-topic")
+}
+
+func TestNATSTransport(t *testing.T) {
+	opts := natsserver.DefaultTestOptions
+	opts.Port = -1
+	server := natsserver.RunServer(&opts)
+	defer server.Shutdown()
+
+	conn, err := nats.Connect(server.ClientURL())
+	assert.Nil(t, err)
+	defer conn.Close()
+	testTransport(t, NewNATSTransport(conn, ""), "nats.topic")
+
+	// members of a queue group share messages
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	received := make(chan string, 4)
+	for _, name := range []string{"a", "b"} {
+		name := name
+		service := NewWithTransport(NewNATSTransport(conn, "workers"))
+		_, err := service.SubscribeFunc(ctx, "nats.queue", helloFactory, func(ctx context.Context, msg proto.Message) error {
+			received <- name
+			return nil
+		})
+		assert.Nil(t, err)
+	}
+	service := NewWithTransport(NewNATSTransport(conn, ""))
+	assert.Nil(t, service.Publish(ctx, "nats.queue", &test.HelloWorld{Name: "job"}))
+	select {
+	case <-received:
+	case <-time.After(time.Second):
+		t.Fatal("message is not received")
+	}
+	select {
+	case name := <-received:
+		t.Fatalf("message is handled twice, second time by %s", name)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestWithTransport(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	memory := NewMemoryTransport()
+	service := New(redisClient, WithTransport("local-topic", memory))
+	received := make(chan string, 1)
+	_, err := service.SubscribeFunc(ctx, "local-topic", helloFactory, func(ctx context.Context, msg proto.Message) error {
+		received <- msg.(*test.HelloWorld).Name
+		return nil
+	})
+	assert.Nil(t, err)
+
+	// messages of topic don't go through redis
+	num, err := redisClient.PubSubNumSub(ctx, "local-topic").Result()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), num["local-topic"])
+
+	assert.Nil(t, service.Publish(ctx, "local-topic", &test.HelloWorld{Name: "local"}))
+	select {
+	case got := <-received:
+		assert.Equal(t, "local", got)
+	case <-time.After(time.Second):
+		t.Fatal("message is not received")
+	}
+}
+
+// flakyTransport fails first subscriptions like a transport which is not reachable yet
+type flakyTransport struct {
+	Transport
+	failures int32
+}
+
+func (f *flakyTransport) Subscribe(ctx context.Context, topic string, fn DeliverFunc) error {
+	if atomic.AddInt32(&f.failures, -1) >= 0 {
+		return errors.New("connection refused")
+	}
+	return f.Transport.Subscribe(ctx, topic, fn)
+}
+
+func TestSubscribeTransportError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	policy := resubscribePolicy
+	resubscribePolicy = RetryPolicy{InitialBackoff: 10 * time.Millisecond}.withDefaults()
+	defer func() { resubscribePolicy = policy }()
+
+	service := NewWithTransport(&flakyTransport{Transport: NewMemoryTransport(), failures: 2})
+	received := make(chan string, 1)
+	assert.NotPanics(t, func() {
+		service.Subscribe(ctx, "flaky-topic", func(ctx context.Context, msg *test.HelloWorld) {
+			received <- msg.Name
+		})
+	})
+	assert.Panics(t, func() {
+		service.Subscribe(ctx, "flaky-topic", func(msg *test.HelloWorld) {})
+	})
+
+	// subscription is retried in background
+	assert.Eventually(t, func() bool {
+		assert.Nil(t, service.Publish(ctx, "flaky-topic", &test.HelloWorld{Name: "retried"}))
+		select {
+		case got := <-received:
+			return got == "retried"
+		case <-time.After(10 * time.Millisecond):
+			return false
+		}
+	}, time.Second, 10*time.Millisecond)
+}
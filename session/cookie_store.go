@@ -0,0 +1,127 @@
+package session
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidToken is returned when a client side session token is malformed or its signature is invalid
+	ErrInvalidToken = errors.New("session: invalid token")
+
+	// ErrTokenTooLarge is returned when encoded session does not fit in a cookie
+	ErrTokenTooLarge = errors.New("session: token is too large")
+)
+
+// maxCookieSize is the size limit of a cookie value in most browsers
+const maxCookieSize = 4096
+
+// CookieStore is a Store that keep the whole session in the client cookie, session is
+// signed using HMAC-SHA256 and optionally encrypted using AES-GCM. Sessions can not be
+// revoked before they expire since nothing is stored on server
+type CookieStore struct {
+	hashKey []byte
+	aead    cipher.AEAD
+}
+
+// NewCookieStore returns a client side Store, hashKey is used to sign sessions and if blockKey
+// is not nil sessions are encrypted too, blockKey should be 16, 24 or 32 bytes to select
+// AES-128, AES-192 or AES-256
+func NewCookieStore(hashKey, blockKey []byte) (*CookieStore, error) {
+	if len(hashKey) == 0 {
+		return nil, errors.New("session: hash key is required")
+	}
+
+	c := &CookieStore{hashKey: hashKey}
+	if blockKey != nil {
+		block, err := aes.NewCipher(blockKey)
+		if err != nil {
+			return nil, err
+		}
+		c.aead, err = cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *CookieStore) mac(data string) []byte {
+	h := hmac.New(sha256.New, c.hashKey)
+	_, _ = h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// Load implements Store
+func (c *CookieStore) Load(ctx context.Context, token string) (*Session, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return nil, ErrInvalidToken
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(sig, c.mac(parts[0])) {
+		return nil, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil || len(payload) < 8 {
+		return nil, ErrInvalidToken
+	}
+	if time.Now().Unix() > int64(binary.BigEndian.Uint64(payload[:8])) {
+		return nil, ErrNotFound
+	}
+
+	data := payload[8:]
+	if c.aead != nil {
+		ns := c.aead.NonceSize()
+		if len(data) < ns {
+			return nil, ErrInvalidToken
+		}
+		data, err = c.aead.Open(nil, data[:ns], data[ns:], payload[:8])
+		if err != nil {
+			return nil, ErrInvalidToken
+		}
+	}
+	return codec{}.decode(data)
+}
+
+// Save implements Store
+func (c *CookieStore) Save(ctx context.Context, s *Session, ttl time.Duration) (string, error) {
+	data, err := codec{}.encode(s)
+	if err != nil {
+		return "", err
+	}
+
+	expiry := make([]byte, 8)
+	binary.BigEndian.PutUint64(expiry, uint64(time.Now().Add(ttl).Unix()))
+
+	if c.aead != nil {
+		nonce := make([]byte, c.aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return "", err
+		}
+		data = c.aead.Seal(nonce, nonce, data, expiry)
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(append(expiry, data...))
+	token := payload + "." + base64.RawURLEncoding.EncodeToString(c.mac(payload))
+	if len(token) > maxCookieSize {
+		return "", ErrTokenTooLarge
+	}
+	return token, nil
+}
+
+// Delete implements Store, client side sessions are removed by clearing the cookie
+func (c *CookieStore) Delete(ctx context.Context, token string) error {
+	return nil
+}
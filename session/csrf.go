@@ -0,0 +1,329 @@
+package session
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"mime"
+	"net/http"
+
+	"github.com/golang-tire/pkg/log"
+)
+
+// CSRFMode is the way a CSRF token is bound to session
+type CSRFMode int
+
+const (
+	// CSRFSynchronizer keep the token in session values, it needs a server side store
+	CSRFSynchronizer CSRFMode = iota
+	// CSRFDoubleSubmit keep the token in a cookie signed for the session id, request should
+	// send the same token in header or form field
+	CSRFDoubleSubmit
+)
+
+// csrfTokenSize is number of random bytes in a csrf token
+const csrfTokenSize = 32
+
+// csrfSessionKey is the session value key of synchronizer tokens
+const csrfSessionKey = "_csrf"
+
+// ErrCSRFInvalid is passed to CSRF error handler when token is missing or does not match
+var ErrCSRFInvalid = errors.New("session: invalid csrf token")
+
+type csrfOptions struct {
+	mode         CSRFMode
+	key          []byte
+	headerName   string
+	fieldName    string
+	cookieName   string
+	errorHandler http.Handler
+}
+
+// A CSRFOption sets options such as mode and token header of CSRF middleware
+type CSRFOption interface {
+	apply(*csrfOptions)
+}
+
+// funcCSRFOption wraps a function that modifies csrfOptions into an
+// implementation of the CSRFOption interface.
+type funcCSRFOption struct {
+	f func(*csrfOptions)
+}
+
+func (fco *funcCSRFOption) apply(co *csrfOptions) {
+	fco.f(co)
+}
+
+func newFuncCSRFOption(f func(*csrfOptions)) *funcCSRFOption {
+	return &funcCSRFOption{
+		f: f,
+	}
+}
+
+// WithCSRFMode returns a CSRFOption that set how tokens are bound to session, default is CSRFSynchronizer
+func WithCSRFMode(mode CSRFMode) CSRFOption {
+	return newFuncCSRFOption(func(o *csrfOptions) {
+		o.mode = mode
+	})
+}
+
+// CSRFKey returns a CSRFOption that set the secret used to sign double submit cookies,
+// it's required in CSRFDoubleSubmit mode and should be shared between instances
+func CSRFKey(key []byte) CSRFOption {
+	return newFuncCSRFOption(func(o *csrfOptions) {
+		o.key = key
+	})
+}
+
+// CSRFHeader returns a CSRFOption that set request header of token, default is X-CSRF-Token.
+// Token of safe requests is also exposed in this response header for javascript clients
+func CSRFHeader(name string) CSRFOption {
+	return newFuncCSRFOption(func(o *csrfOptions) {
+		o.headerName = name
+	})
+}
+
+// CSRFField returns a CSRFOption that set form field of token, default is csrf_token
+func CSRFField(name string) CSRFOption {
+	return newFuncCSRFOption(func(o *csrfOptions) {
+		o.fieldName = name
+	})
+}
+
+// CSRFCookieName returns a CSRFOption that set cookie name of double submit mode, default is csrf_token
+func CSRFCookieName(name string) CSRFOption {
+	return newFuncCSRFOption(func(o *csrfOptions) {
+		o.cookieName = name
+	})
+}
+
+// CSRFErrorHandler returns a CSRFOption that set handler of rejected requests,
+// default handler responds 403 Forbidden
+func CSRFErrorHandler(h http.Handler) CSRFOption {
+	return newFuncCSRFOption(func(o *csrfOptions) {
+		o.errorHandler = h
+	})
+}
+
+type csrfContextKey struct{}
+
+type csrfState struct {
+	token     []byte
+	fieldName string
+}
+
+// CSRFToken returns a masked CSRF token of request to send in header or form field, a different
+// value is returned on each call to prevent BREACH attacks. It returns empty string if CSRF
+// middleware is not used
+func CSRFToken(ctx context.Context) string {
+	st, ok := ctx.Value(csrfContextKey{}).(*csrfState)
+	if !ok {
+		return ""
+	}
+	return maskToken(st.token)
+}
+
+// CSRFTemplateField returns a hidden input with CSRF token to use in html forms
+func CSRFTemplateField(ctx context.Context) template.HTML {
+	st, ok := ctx.Value(csrfContextKey{}).(*csrfState)
+	if !ok {
+		return ""
+	}
+	return template.HTML(fmt.Sprintf(`<input type="hidden" name="%s" value="%s">`,
+		template.HTMLEscapeString(st.fieldName), maskToken(st.token)))
+}
+
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// maskToken xor token with a one time pad and returns pad and result together
+func maskToken(token []byte) string {
+	pad, err := randomBytes(len(token))
+	if err != nil {
+		return base64.RawURLEncoding.EncodeToString(token)
+	}
+	masked := make([]byte, 2*len(token))
+	copy(masked, pad)
+	for i := range token {
+		masked[len(token)+i] = pad[i] ^ token[i]
+	}
+	return base64.RawURLEncoding.EncodeToString(masked)
+}
+
+// unmaskToken returns token of a masked or plain token
+func unmaskToken(s string, size int) []byte {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil
+	}
+	switch len(b) {
+	case size:
+		return b
+	case 2 * size:
+		token := make([]byte, size)
+		for i := range token {
+			token[i] = b[i] ^ b[size+i]
+		}
+		return token
+	}
+	return nil
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+func csrfForbidden(w http.ResponseWriter, r *http.Request) {
+	http.Error(w, ErrCSRFInvalid.Error(), http.StatusForbidden)
+}
+
+type csrf struct {
+	m    *Manager
+	opts csrfOptions
+}
+
+// CSRF returns an http middleware that bind a CSRF token to session and validate it on unsafe
+// methods. It should be placed after session Middleware, e.g. on grpc-gateway mux:
+//
+//	grpcgw.HttpMiddlewares(m.Middleware, csrfMiddleware)
+func (m *Manager) CSRF(opts ...CSRFOption) (func(http.Handler) http.Handler, error) {
+	o := csrfOptions{
+		headerName:   "X-CSRF-Token",
+		fieldName:    "csrf_token",
+		cookieName:   "csrf_token",
+		errorHandler: http.HandlerFunc(csrfForbidden),
+	}
+	for _, opt := range opts {
+		opt.apply(&o)
+	}
+	if o.mode == CSRFDoubleSubmit && len(o.key) == 0 {
+		return nil, errors.New("session: csrf key is required in double submit mode")
+	}
+
+	c := &csrf{m: m, opts: o}
+	return c.middleware, nil
+}
+
+func (c *csrf) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := FromContext(r.Context())
+		if s == nil {
+			log.Error("session: csrf middleware is used without session middleware")
+			c.opts.errorHandler.ServeHTTP(w, r)
+			return
+		}
+
+		var (
+			token []byte
+			valid bool
+			err   error
+		)
+		if c.opts.mode == CSRFDoubleSubmit {
+			token, valid, err = c.doubleSubmitToken(w, r, s)
+		} else {
+			token, valid, err = c.synchronizerToken(s)
+		}
+		if err != nil {
+			log.Error("session: create csrf token failed", log.Err(err))
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		if isSafeMethod(r.Method) {
+			w.Header().Set(c.opts.headerName, maskToken(token))
+		} else {
+			sent := unmaskToken(c.requestToken(r), len(token))
+			if !valid || sent == nil || subtle.ConstantTimeCompare(sent, token) != 1 {
+				c.opts.errorHandler.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		ctx := context.WithValue(r.Context(), csrfContextKey{}, &csrfState{token: token, fieldName: c.opts.fieldName})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requestToken returns token sent in header or form field
+func (c *csrf) requestToken(r *http.Request) string {
+	if v := r.Header.Get(c.opts.headerName); v != "" {
+		return v
+	}
+	ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if ct == "application/x-www-form-urlencoded" || ct == "multipart/form-data" {
+		return r.PostFormValue(c.opts.fieldName)
+	}
+	return ""
+}
+
+// synchronizerToken returns token stored in session or create a new one
+func (c *csrf) synchronizerToken(s *Session) ([]byte, bool, error) {
+	var encoded string
+	if err := s.Get(csrfSessionKey, &encoded); err == nil {
+		if token, err := base64.RawURLEncoding.DecodeString(encoded); err == nil && len(token) == csrfTokenSize {
+			return token, true, nil
+		}
+	}
+
+	token, err := randomBytes(csrfTokenSize)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := s.Set(csrfSessionKey, base64.RawURLEncoding.EncodeToString(token)); err != nil {
+		return nil, false, err
+	}
+	return token, false, nil
+}
+
+func (c *csrf) sign(sessionID string, nonce []byte) []byte {
+	h := hmac.New(sha256.New, c.opts.key)
+	_, _ = h.Write([]byte(sessionID))
+	_, _ = h.Write(nonce)
+	return h.Sum(nil)
+}
+
+// doubleSubmitToken returns token of csrf cookie if it's signed for session or set a new cookie,
+// double submit tokens are nonce and its signature together
+func (c *csrf) doubleSubmitToken(w http.ResponseWriter, r *http.Request, s *Session) ([]byte, bool, error) {
+	if ck, err := r.Cookie(c.opts.cookieName); err == nil {
+		token, err := base64.RawURLEncoding.DecodeString(ck.Value)
+		if err == nil && len(token) == 2*csrfTokenSize &&
+			hmac.Equal(token[csrfTokenSize:], c.sign(s.ID, token[:csrfTokenSize])) {
+			return token, true, nil
+		}
+	}
+
+	nonce, err := randomBytes(csrfTokenSize)
+	if err != nil {
+		return nil, false, err
+	}
+	token := append(nonce, c.sign(s.ID, nonce)...)
+	// token is bound to session id so session must be kept
+	s.touch()
+
+	o := c.m.opts
+	http.SetCookie(w, &http.Cookie{
+		Name:     c.opts.cookieName,
+		Value:    base64.RawURLEncoding.EncodeToString(token),
+		Path:     o.cookiePath,
+		Domain:   o.cookieDomain,
+		Secure:   o.secure,
+		SameSite: o.sameSite,
+	})
+	return token, false, nil
+}
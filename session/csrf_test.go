@@ -0,0 +1,118 @@
+package session
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func csrfHandler(t *testing.T, m *Manager, opts ...CSRFOption) http.Handler {
+	mw, err := m.CSRF(opts...)
+	assert.Nil(t, err)
+	return m.Middleware(mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(CSRFTemplateField(r.Context())))
+	})))
+}
+
+func withCookies(r *http.Request, cookies []*http.Cookie) *http.Request {
+	for _, c := range cookies {
+		r.AddCookie(c)
+	}
+	return r
+}
+
+func TestCSRFSynchronizer(t *testing.T) {
+	m := NewManager()
+	h := csrfHandler(t, m)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	cookies := w.Result().Cookies()
+	assert.Len(t, cookies, 1)
+	token := w.Header().Get("X-CSRF-Token")
+	assert.NotEmpty(t, token)
+	assert.Contains(t, w.Body.String(), `name="csrf_token"`)
+
+	// masked tokens differ on each request but all are valid
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, withCookies(httptest.NewRequest(http.MethodGet, "/", nil), cookies))
+	assert.NotEqual(t, token, w.Header().Get("X-CSRF-Token"))
+
+	// missing token
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, withCookies(httptest.NewRequest(http.MethodPost, "/", nil), cookies))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// header
+	r := withCookies(httptest.NewRequest(http.MethodPost, "/", nil), cookies)
+	r.Header.Set("X-CSRF-Token", token)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// form field
+	form := url.Values{"csrf_token": {token}}
+	r = withCookies(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode())), cookies)
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// token of another session
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	r = withCookies(httptest.NewRequest(http.MethodPost, "/", nil), cookies)
+	r.Header.Set("X-CSRF-Token", w.Header().Get("X-CSRF-Token"))
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestCSRFDoubleSubmit(t *testing.T) {
+	m := NewManager()
+	_, err := m.CSRF(WithCSRFMode(CSRFDoubleSubmit))
+	assert.NotNil(t, err)
+
+	h := csrfHandler(t, m, WithCSRFMode(CSRFDoubleSubmit), CSRFKey([]byte("csrf-key")))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	cookies := w.Result().Cookies()
+	assert.Len(t, cookies, 2)
+	var csrfCookie *http.Cookie
+	for _, c := range cookies {
+		if c.Name == "csrf_token" {
+			csrfCookie = c
+		}
+	}
+	assert.NotNil(t, csrfCookie)
+
+	// plain cookie value and masked token are both accepted
+	for _, token := range []string{csrfCookie.Value, w.Header().Get("X-CSRF-Token")} {
+		r := withCookies(httptest.NewRequest(http.MethodPost, "/", nil), cookies)
+		r.Header.Set("X-CSRF-Token", token)
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+
+	// cookie is bound to session
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	var other []*http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name != "csrf_token" {
+			other = append(other, c)
+		}
+	}
+	r := withCookies(httptest.NewRequest(http.MethodPost, "/", nil), append(other, csrfCookie))
+	r.Header.Set("X-CSRF-Token", csrfCookie.Value)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
@@ -0,0 +1,180 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-tire/pkg/log"
+	"github.com/golang-tire/pkg/pubsub"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// ErrNotificationsDisabled is returned by WatchExpired when expired events of redis keyspace
+// notifications are not enabled, see ConfigureNotifications
+var ErrNotificationsDisabled = errors.New("session: redis keyspace notifications of expired keys are disabled")
+
+// EventType is type of a session lifecycle event
+type EventType string
+
+const (
+	// EventCreated is emitted when a new session is saved for the first time
+	EventCreated EventType = "created"
+	// EventRefreshed is emitted when an existing session is saved
+	EventRefreshed EventType = "refreshed"
+	// EventExpired is emitted when a session reach its idle timeout or absolute expiry
+	EventExpired EventType = "expired"
+	// EventRevoked is emitted when a session is destroyed or revoked
+	EventRevoked EventType = "revoked"
+)
+
+// Event is a session lifecycle event, UserID may be empty for expired sessions which are
+// already removed from store
+type Event struct {
+	Type      EventType
+	SessionID string
+	UserID    string
+	Time      time.Time
+}
+
+// Listener receives session lifecycle events, it's called synchronously so it should not block
+type Listener interface {
+	OnSessionEvent(ctx context.Context, e Event)
+}
+
+// ListenerFunc is an adapter to use a function as Listener
+type ListenerFunc func(ctx context.Context, e Event)
+
+// OnSessionEvent implements Listener
+func (f ListenerFunc) OnSessionEvent(ctx context.Context, e Event) {
+	f(ctx, e)
+}
+
+// WithListener returns a ManagerOption that add a listener of session lifecycle events
+func WithListener(l Listener) ManagerOption {
+	return newFuncManagerOption(func(o *managerOptions) {
+		o.listeners = append(o.listeners, l)
+	})
+}
+
+// ConfigureNotifications returns a ManagerOption that let WatchExpired enable expired events of
+// redis keyspace notifications using CONFIG SET, it changes configuration of the whole redis server
+// so it's disabled by default and notify-keyspace-events should be set to include "Ex" instead
+func ConfigureNotifications(b bool) ManagerOption {
+	return newFuncManagerOption(func(o *managerOptions) {
+		o.configureNotifications = b
+	})
+}
+
+// expiredEventsEnabled check if notify-keyspace-events flags include expired events
+func expiredEventsEnabled(flags string) bool {
+	return strings.Contains(flags, "E") && (strings.Contains(flags, "x") || strings.Contains(flags, "A"))
+}
+
+// expiryNotifier is implemented by stores which detect expired sessions themselves
+type expiryNotifier interface {
+	onExpired(fn func(s *Session))
+}
+
+func (m *Manager) emit(ctx context.Context, t EventType, id, userID string) {
+	if len(m.opts.listeners) == 0 {
+		return
+	}
+
+	e := Event{Type: t, SessionID: id, UserID: userID, Time: time.Now()}
+	for _, l := range m.opts.listeners {
+		l.OnSessionEvent(ctx, e)
+	}
+}
+
+// expired handle sessions removed by store sweeper
+func (m *Manager) expired(s *Session) {
+	ctx := context.Background()
+	if err := m.unindex(ctx, s.UserID, s.ID); err != nil {
+		log.Error("session: remove expired session from index failed", log.String("id", s.ID), log.Err(err))
+	}
+	m.emit(ctx, EventExpired, s.ID, s.UserID)
+}
+
+// WatchExpired subscribe to redis keyspace notifications and emit EventExpired for sessions
+// expired in redis until ctx is done. It returns ErrNotificationsDisabled if expired events of
+// redis are not enabled, unless ConfigureNotifications is set. It's only useful for the default
+// redis store and each subscribed instance receives all events
+func (m *Manager) WatchExpired(ctx context.Context) error {
+	c := m.client()
+	if c == nil {
+		return ErrNoStore
+	}
+	rdb := c.Redis()
+
+	cfg, err := rdb.ConfigGet(ctx, "notify-keyspace-events").Result()
+	if err != nil {
+		// CONFIG is disabled on some managed redis services, notifications are configured there
+		// by the provider so they are assumed to be enabled
+		log.Error("session: check keyspace notifications failed", log.Err(err))
+	} else {
+		var flags string
+		if len(cfg) == 2 {
+			flags, _ = cfg[1].(string)
+		}
+		if !expiredEventsEnabled(flags) {
+			if !m.opts.configureNotifications {
+				return ErrNotificationsDisabled
+			}
+			if err := rdb.ConfigSet(ctx, "notify-keyspace-events", flags+"Ex").Err(); err != nil {
+				return err
+			}
+		}
+	}
+
+	sub := rdb.Subscribe(ctx, fmt.Sprintf("__keyevent@%d__:expired", rdb.Options().DB))
+	if _, err := sub.Receive(ctx); err != nil {
+		_ = sub.Close()
+		return err
+	}
+
+	prefix := c.Key(m.opts.keyPrefix)
+	go func() {
+		defer sub.Close()
+
+		ch := sub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-ch:
+				if !ok {
+					return
+				}
+				id := strings.TrimPrefix(msg.Payload, prefix)
+				// session ids never contain ':', other keys like user index are skipped
+				if id == msg.Payload || strings.Contains(id, ":") {
+					continue
+				}
+				m.emit(ctx, EventExpired, id, "")
+			}
+		}
+	}()
+	return nil
+}
+
+// NewPublisher returns a Listener that publish session events on topic using pubsub service,
+// events are published as a structpb.Struct with type, session_id, user_id and time fields
+func NewPublisher(ps pubsub.Service, topic string) Listener {
+	return ListenerFunc(func(ctx context.Context, e Event) {
+		msg, err := structpb.NewStruct(map[string]interface{}{
+			"type":       string(e.Type),
+			"session_id": e.SessionID,
+			"user_id":    e.UserID,
+			"time":       e.Time.Format(time.RFC3339Nano),
+		})
+		if err == nil {
+			err = ps.Publish(ctx, topic, msg)
+		}
+		if err != nil {
+			log.Error("session: publish event failed", log.String("type", string(e.Type)), log.Err(err))
+		}
+	})
+}
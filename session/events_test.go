@@ -0,0 +1,134 @@
+package session
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-tire/pkg/kv"
+	"github.com/golang-tire/pkg/pubsub"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+type eventRecorder struct {
+	lock   sync.Mutex
+	events []Event
+}
+
+func (r *eventRecorder) OnSessionEvent(ctx context.Context, e Event) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.events = append(r.events, e)
+}
+
+func (r *eventRecorder) types() []EventType {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var types []EventType
+	for _, e := range r.events {
+		types = append(types, e.Type)
+	}
+	return types
+}
+
+func TestEvents(t *testing.T) {
+	ctx := context.Background()
+	rec := &eventRecorder{}
+	m := NewManager(KeyPrefix("events:"), IdleTimeout(time.Hour), WithListener(rec))
+
+	s, err := m.New(ctx)
+	assert.Nil(t, err)
+	s.SetUser("u1")
+	assert.Nil(t, m.Save(ctx, s))
+	assert.Nil(t, s.Set("a", 1))
+	assert.Nil(t, m.Save(ctx, s))
+	assert.Nil(t, m.Destroy(ctx, s))
+	assert.Equal(t, []EventType{EventCreated, EventRefreshed, EventRevoked}, rec.types())
+	assert.Equal(t, "u1", rec.events[2].UserID)
+
+	// idle sessions expire on load
+	rec.events = nil
+	s, _ = m.New(ctx)
+	assert.Nil(t, m.Save(ctx, s))
+	loaded, _ := m.Load(ctx, s.ID)
+	loaded.LastSeen = time.Now().Add(-2 * time.Hour)
+	_, err = NewRedisStore(kv.Get(), "events:").Save(ctx, loaded, time.Hour)
+	assert.Nil(t, err)
+	_, err = m.Load(ctx, s.ID)
+	assert.Equal(t, ErrNotFound, err)
+	assert.Equal(t, []EventType{EventCreated, EventExpired}, rec.types())
+}
+
+func TestMemoryStoreExpiredEvents(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rec := &eventRecorder{}
+	m := NewManager(WithStore(NewMemoryStore(ctx, 10*time.Millisecond)), WithListener(rec), IdleTimeout(20*time.Millisecond))
+
+	s, err := m.New(ctx)
+	assert.Nil(t, err)
+	s.SetUser("u1")
+	assert.Nil(t, m.Save(ctx, s))
+
+	assert.Eventually(t, func() bool {
+		types := rec.types()
+		return len(types) == 2 && types[1] == EventExpired
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, "u1", rec.events[1].UserID)
+	assert.Equal(t, s.ID, rec.events[1].SessionID)
+}
+
+func TestWatchExpired(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rec := &eventRecorder{}
+	m := NewManager(WithListener(rec))
+	assert.Nil(t, m.WatchExpired(ctx))
+
+	// miniredis has no keyspace notifications so they are published by hand
+	rdb := kv.Get().Redis()
+	assert.Nil(t, rdb.Publish(ctx, "__keyevent@0__:expired", "session:user:u1").Err())
+	assert.Nil(t, rdb.Publish(ctx, "__keyevent@0__:expired", "other").Err())
+	assert.Nil(t, rdb.Publish(ctx, "__keyevent@0__:expired", "session:abc").Err())
+
+	assert.Eventually(t, func() bool {
+		return len(rec.types()) == 1
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, "abc", rec.events[0].SessionID)
+	assert.Equal(t, EventExpired, rec.events[0].Type)
+}
+
+func TestExpiredEventsEnabled(t *testing.T) {
+	assert.False(t, expiredEventsEnabled(""))
+	assert.False(t, expiredEventsEnabled("Kx"))
+	assert.False(t, expiredEventsEnabled("E$"))
+	assert.True(t, expiredEventsEnabled("Ex"))
+	assert.True(t, expiredEventsEnabled("KEA"))
+}
+
+func TestPublisher(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ps := pubsub.New(kv.Get().Redis())
+	received := make(chan *structpb.Struct, 1)
+	ps.Subscribe(ctx, "session.events", func(ctx context.Context, msg *structpb.Struct) {
+		received <- msg
+	})
+	time.Sleep(50 * time.Millisecond)
+
+	NewPublisher(ps, "session.events").OnSessionEvent(ctx, Event{Type: EventRevoked, SessionID: "id", UserID: "u1", Time: time.Now()})
+	select {
+	case msg := <-received:
+		assert.Equal(t, "revoked", msg.Fields["type"].GetStringValue())
+		assert.Equal(t, "id", msg.Fields["session_id"].GetStringValue())
+		assert.Equal(t, "u1", msg.Fields["user_id"].GetStringValue())
+	case <-time.After(time.Second):
+		t.Fatal("event is not published")
+	}
+}
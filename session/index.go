@@ -0,0 +1,158 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotIndexed is returned by ListSessions and RevokeAll when store does not index sessions by user
+var ErrNotIndexed = errors.New("session: store does not index sessions by user")
+
+// Indexer is implemented by stores which keep an index of session ids by user next to sessions,
+// it's used by ListSessions and RevokeAll
+type Indexer interface {
+	// Index add session id to index of user until expiresAt
+	Index(ctx context.Context, userID, id string, expiresAt time.Time) error
+	// Unindex remove session ids from index of user
+	Unindex(ctx context.Context, userID string, ids ...string) error
+	// UserSessions returns indexed session ids of user, they may include removed sessions
+	UserSessions(ctx context.Context, userID string) ([]string, error)
+}
+
+// indexer returns store of manager as an Indexer
+func (m *Manager) indexer() (Indexer, error) {
+	st, err := m.store()
+	if err != nil {
+		return nil, err
+	}
+	idx, ok := st.(Indexer)
+	if !ok {
+		return nil, ErrNotIndexed
+	}
+	return idx, nil
+}
+
+// index add session to its user index, sessions without user or in stores without index are not indexed
+func (m *Manager) index(ctx context.Context, userID, id string, expiresAt time.Time) error {
+	if userID == "" {
+		return nil
+	}
+	idx, err := m.indexer()
+	if err != nil {
+		return nil
+	}
+	return idx.Index(ctx, userID, id, expiresAt)
+}
+
+// unindex remove session ids from their user index
+func (m *Manager) unindex(ctx context.Context, userID string, ids ...string) error {
+	if userID == "" {
+		return nil
+	}
+	idx, err := m.indexer()
+	if err != nil {
+		return nil
+	}
+
+	members := ids[:0:0]
+	for _, id := range ids {
+		if id != "" {
+			members = append(members, id)
+		}
+	}
+	if len(members) == 0 {
+		return nil
+	}
+	return idx.Unindex(ctx, userID, members...)
+}
+
+// ListSessions returns active sessions of user, sessions are indexed when they are saved with
+// a user using a store that implements Indexer, otherwise it returns ErrNotIndexed
+func (m *Manager) ListSessions(ctx context.Context, userID string) ([]*Session, error) {
+	idx, err := m.indexer()
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := idx.UserSessions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		sessions []*Session
+		stale    []string
+	)
+	for _, id := range members {
+		s, err := m.Load(ctx, id)
+		if err == ErrNotFound {
+			stale = append(stale, id)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if s.UserID != userID {
+			stale = append(stale, id)
+			continue
+		}
+		sessions = append(sessions, s)
+	}
+
+	if len(stale) > 0 {
+		if err := m.unindex(ctx, userID, stale...); err != nil {
+			return nil, err
+		}
+	}
+	return sessions, nil
+}
+
+// Revoke remove a session by its id, it returns ErrNotFound if session does not exist
+func (m *Manager) Revoke(ctx context.Context, id string) error {
+	s, err := m.Load(ctx, id)
+	if err != nil {
+		return err
+	}
+	return m.Destroy(ctx, s)
+}
+
+// RevokeAll remove all sessions of user except given session ids and returns number of
+// revoked sessions. It can be used to log a user out everywhere on password change
+func (m *Manager) RevokeAll(ctx context.Context, userID string, except ...string) (int, error) {
+	st, err := m.store()
+	if err != nil {
+		return 0, err
+	}
+	idx, err := m.indexer()
+	if err != nil {
+		return 0, err
+	}
+
+	members, err := idx.UserSessions(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	keep := make(map[string]bool, len(except))
+	for _, id := range except {
+		keep[id] = true
+	}
+
+	var revoked []string
+	for _, id := range members {
+		if keep[id] {
+			continue
+		}
+		if err := st.Delete(ctx, id); err != nil {
+			return len(revoked), err
+		}
+		revoked = append(revoked, id)
+		m.emit(ctx, EventRevoked, id, userID)
+	}
+
+	if err := m.unindex(ctx, userID, revoked...); err != nil {
+		return len(revoked), err
+	}
+	return len(revoked), nil
+}
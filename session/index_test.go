@@ -0,0 +1,99 @@
+package session
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-tire/pkg/kv"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func testUserIndex(t *testing.T, m *Manager) {
+	ctx := context.Background()
+	// user ids are unique per run since redis is shared by tests
+	u1, u2 := "u1-"+uuid.New().String(), "u2-"+uuid.New().String()
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		s, err := m.New(ctx)
+		assert.Nil(t, err)
+		s.SetUser(u1)
+		assert.Nil(t, m.Save(ctx, s))
+		ids = append(ids, s.ID)
+	}
+
+	other, err := m.New(ctx)
+	assert.Nil(t, err)
+	other.SetUser(u2)
+	assert.Nil(t, m.Save(ctx, other))
+
+	sessions, err := m.ListSessions(ctx, u1)
+	assert.Nil(t, err)
+	assert.Len(t, sessions, 3)
+
+	// regenerate replace id in index
+	s, err := m.Load(ctx, ids[0])
+	assert.Nil(t, err)
+	assert.Nil(t, m.Regenerate(ctx, s))
+	assert.Nil(t, m.Save(ctx, s))
+	ids[0] = s.ID
+	sessions, err = m.ListSessions(ctx, u1)
+	assert.Nil(t, err)
+	var listed []string
+	for _, s := range sessions {
+		listed = append(listed, s.ID)
+	}
+	assert.ElementsMatch(t, ids, listed)
+
+	assert.Nil(t, m.Revoke(ctx, ids[1]))
+	assert.Equal(t, ErrNotFound, m.Revoke(ctx, ids[1]))
+	sessions, err = m.ListSessions(ctx, u1)
+	assert.Nil(t, err)
+	assert.Len(t, sessions, 2)
+
+	n, err := m.RevokeAll(ctx, u1, ids[0])
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	_, err = m.Load(ctx, ids[2])
+	assert.Equal(t, ErrNotFound, err)
+	_, err = m.Load(ctx, ids[0])
+	assert.Nil(t, err)
+
+	sessions, err = m.ListSessions(ctx, u2)
+	assert.Nil(t, err)
+	assert.Len(t, sessions, 1)
+}
+
+func TestUserIndex(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	testUserIndex(t, NewManager(KeyPrefix("index:")))
+	testUserIndex(t, NewManager(WithStore(NewMemoryStore(ctx, time.Minute))))
+	testUserIndex(t, NewManager(WithStore(NewKVStore(kv.NewInMemory(ctx).Store(), "index:"))))
+
+	st, err := NewCookieStore([]byte("hash-key"), nil)
+	assert.Nil(t, err)
+	_, err = NewManager(WithStore(st)).ListSessions(ctx, "u1")
+	assert.Equal(t, ErrNotIndexed, err)
+}
+
+func TestMetadata(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set("User-Agent", "Mozilla/5.0 (iPhone; CPU iPhone OS 14_0 like Mac OS X) Mobile/15E148")
+	r.Header.Set("X-Forwarded-For", "1.2.3.4, 10.0.0.2")
+
+	s, err := NewManager().FromRequest(r)
+	assert.Nil(t, err)
+	assert.Equal(t, "10.0.0.1", s.Metadata.IP)
+	assert.Equal(t, "mobile", s.Metadata.Device)
+
+	s, err = NewManager(TrustProxyHeaders(true)).FromRequest(r)
+	assert.Nil(t, err)
+	assert.Equal(t, "1.2.3.4", s.Metadata.IP)
+	assert.Equal(t, r.UserAgent(), s.Metadata.UserAgent)
+}
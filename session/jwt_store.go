@@ -0,0 +1,408 @@
+package session
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-tire/pkg/kv"
+)
+
+// JWT signing algorithms supported by JWTStore
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	EdDSA = "EdDSA"
+)
+
+// SigningKey is a key used to sign or verify session tokens, HS256 keys use Secret and
+// RS256 and EdDSA keys use PrivateKey to sign and PublicKey to verify. Keys without a
+// private key or secret can only verify tokens
+type SigningKey struct {
+	ID         string
+	Algorithm  string
+	Secret     []byte
+	PrivateKey crypto.Signer
+	PublicKey  crypto.PublicKey
+}
+
+func (k *SigningKey) validate() error {
+	switch k.Algorithm {
+	case HS256:
+		if len(k.Secret) < minSecretSize {
+			return fmt.Errorf("session: HS256 key %q is shorter than %d bytes", k.ID, minSecretSize)
+		}
+		return nil
+	case RS256, EdDSA:
+	default:
+		return fmt.Errorf("session: unsupported algorithm %q of key %q", k.Algorithm, k.ID)
+	}
+
+	if k.PublicKey == nil && k.PrivateKey != nil {
+		k.PublicKey = k.PrivateKey.Public()
+	}
+	switch k.PublicKey.(type) {
+	case *rsa.PublicKey:
+		if k.Algorithm == RS256 {
+			return nil
+		}
+	case ed25519.PublicKey:
+		if k.Algorithm == EdDSA {
+			return nil
+		}
+	}
+	return fmt.Errorf("session: key %q does not match algorithm %s", k.ID, k.Algorithm)
+}
+
+func (k *SigningKey) canSign() bool {
+	if k.Algorithm == HS256 {
+		return true
+	}
+	return k.PrivateKey != nil
+}
+
+func (k *SigningKey) sign(input []byte) ([]byte, error) {
+	switch k.Algorithm {
+	case HS256:
+		h := hmac.New(sha256.New, k.Secret)
+		_, _ = h.Write(input)
+		return h.Sum(nil), nil
+	case RS256:
+		sum := sha256.Sum256(input)
+		return k.PrivateKey.Sign(rand.Reader, sum[:], crypto.SHA256)
+	default:
+		return k.PrivateKey.Sign(rand.Reader, input, crypto.Hash(0))
+	}
+}
+
+func (k *SigningKey) verify(input, sig []byte) bool {
+	switch k.Algorithm {
+	case HS256:
+		h := hmac.New(sha256.New, k.Secret)
+		_, _ = h.Write(input)
+		return hmac.Equal(sig, h.Sum(nil))
+	case RS256:
+		sum := sha256.Sum256(input)
+		return rsa.VerifyPKCS1v15(k.PublicKey.(*rsa.PublicKey), crypto.SHA256, sum[:], sig) == nil
+	default:
+		return ed25519.Verify(k.PublicKey.(ed25519.PublicKey), input, sig)
+	}
+}
+
+type jwtOptions struct {
+	issuer   string
+	audience string
+	leeway   time.Duration
+	denylist kv.Store
+	prefix   string
+}
+
+// A JWTOption sets options such as issuer and revocation denylist of JWTStore
+type JWTOption interface {
+	apply(*jwtOptions)
+}
+
+// funcJWTOption wraps a function that modifies jwtOptions into an
+// implementation of the JWTOption interface.
+type funcJWTOption struct {
+	f func(*jwtOptions)
+}
+
+func (fjo *funcJWTOption) apply(jo *jwtOptions) {
+	fjo.f(jo)
+}
+
+func newFuncJWTOption(f func(*jwtOptions)) *funcJWTOption {
+	return &funcJWTOption{
+		f: f,
+	}
+}
+
+// JWTIssuer returns a JWTOption that set iss claim of tokens, tokens of other issuers are rejected
+func JWTIssuer(iss string) JWTOption {
+	return newFuncJWTOption(func(o *jwtOptions) {
+		o.issuer = iss
+	})
+}
+
+// JWTAudience returns a JWTOption that set aud claim of tokens, tokens of other audiences are rejected
+func JWTAudience(aud string) JWTOption {
+	return newFuncJWTOption(func(o *jwtOptions) {
+		o.audience = aud
+	})
+}
+
+// JWTLeeway returns a JWTOption that set allowed clock skew on checking token expiry
+func JWTLeeway(d time.Duration) JWTOption {
+	return newFuncJWTOption(func(o *jwtOptions) {
+		o.leeway = d
+	})
+}
+
+// JWTDenylist returns a JWTOption that keep ids of deleted sessions in st until their
+// tokens expire, without it deleted sessions are valid until they expire
+func JWTDenylist(st kv.Store, prefix string) JWTOption {
+	return newFuncJWTOption(func(o *jwtOptions) {
+		o.denylist = st
+		o.prefix = prefix
+	})
+}
+
+// JWTStore is a stateless Store that encode whole session in a signed JWT, it does not need
+// any storage unless a denylist is used for revocation. Sessions can not be listed and
+// concurrent changes are not detected
+type JWTStore struct {
+	lock sync.RWMutex
+	keys []*SigningKey
+	opts jwtOptions
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+	Kid string `json:"kid,omitempty"`
+}
+
+type jwtClaims struct {
+	ID        string                     `json:"jti"`
+	Subject   string                     `json:"sub,omitempty"`
+	Issuer    string                     `json:"iss,omitempty"`
+	Audience  string                     `json:"aud,omitempty"`
+	IssuedAt  int64                      `json:"iat"`
+	ExpiresAt int64                      `json:"exp"`
+	Values    map[string]json.RawMessage `json:"vals,omitempty"`
+	CreatedAt time.Time                  `json:"created_at"`
+	LastSeen  time.Time                  `json:"last_seen"`
+	Deadline  time.Time                  `json:"expires_at"`
+	Metadata  Metadata                   `json:"meta"`
+	Version   int64                      `json:"ver"`
+}
+
+// NewJWTStore returns a JWT based Store, first key signs new tokens and all keys verify them
+// so keys can be rotated by adding a new key in front of old ones
+func NewJWTStore(keys []SigningKey, opts ...JWTOption) (*JWTStore, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("session: jwt store needs at least one key")
+	}
+
+	j := &JWTStore{}
+	for _, opt := range opts {
+		opt.apply(&j.opts)
+	}
+	for i := len(keys) - 1; i >= 0; i-- {
+		if err := j.Rotate(keys[i]); err != nil {
+			return nil, err
+		}
+	}
+	return j, nil
+}
+
+// Rotate add k as the signing key, previous keys are still used to verify tokens
+func (j *JWTStore) Rotate(k SigningKey) error {
+	if err := k.validate(); err != nil {
+		return err
+	}
+
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	for _, old := range j.keys {
+		if old.ID == k.ID {
+			return fmt.Errorf("session: duplicate key id %q", k.ID)
+		}
+	}
+	j.keys = append([]*SigningKey{&k}, j.keys...)
+	return nil
+}
+
+func (j *JWTStore) signingKey() (*SigningKey, error) {
+	j.lock.RLock()
+	defer j.lock.RUnlock()
+
+	if !j.keys[0].canSign() {
+		return nil, fmt.Errorf("session: key %q can not sign", j.keys[0].ID)
+	}
+	return j.keys[0], nil
+}
+
+// verifyKey returns key of kid, tokens without kid are verified using the signing key
+func (j *JWTStore) verifyKey(kid string) *SigningKey {
+	j.lock.RLock()
+	defer j.lock.RUnlock()
+
+	if kid == "" {
+		return j.keys[0]
+	}
+	for _, k := range j.keys {
+		if k.ID == kid {
+			return k
+		}
+	}
+	return nil
+}
+
+func encodeSegment(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeSegment(s string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return ErrInvalidToken
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+// parse verify token signature and returns its claims, expiry is checked by caller
+func (j *JWTStore) parse(token string) (*jwtClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	key := j.verifyKey(header.Kid)
+	// algorithm must be the one of key, so a public key is never used as a hmac secret
+	if key == nil || header.Alg != key.Algorithm {
+		return nil, ErrInvalidToken
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !key.verify([]byte(parts[0]+"."+parts[1]), sig) {
+		return nil, ErrInvalidToken
+	}
+
+	var claims jwtClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if j.opts.issuer != "" && claims.Issuer != j.opts.issuer {
+		return nil, ErrInvalidToken
+	}
+	if j.opts.audience != "" && claims.Audience != j.opts.audience {
+		return nil, ErrInvalidToken
+	}
+	return &claims, nil
+}
+
+// Load implements Store
+func (j *JWTStore) Load(ctx context.Context, token string) (*Session, error) {
+	claims, err := j.parse(token)
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().Add(-j.opts.leeway).Unix() >= claims.ExpiresAt {
+		return nil, ErrNotFound
+	}
+
+	if j.opts.denylist != nil {
+		_, err := j.opts.denylist.Get(ctx, j.opts.prefix+claims.ID)
+		if err == nil {
+			return nil, ErrNotFound
+		}
+		if err != kv.ErrNotFound {
+			return nil, err
+		}
+	}
+
+	values := claims.Values
+	if values == nil {
+		values = make(map[string]json.RawMessage)
+	}
+	return &Session{
+		ID:        claims.ID,
+		Values:    values,
+		CreatedAt: claims.CreatedAt,
+		LastSeen:  claims.LastSeen,
+		ExpiresAt: claims.Deadline,
+		UserID:    claims.Subject,
+		Metadata:  claims.Metadata,
+		Version:   claims.Version,
+	}, nil
+}
+
+// Save implements Store, each save issues a new token which expires after ttl
+func (j *JWTStore) Save(ctx context.Context, s *Session, ttl time.Duration) (string, error) {
+	key, err := j.signingKey()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	header, err := encodeSegment(jwtHeader{Alg: key.Algorithm, Typ: "JWT", Kid: key.ID})
+	if err != nil {
+		return "", err
+	}
+	claims, err := encodeSegment(jwtClaims{
+		ID:        s.ID,
+		Subject:   s.UserID,
+		Issuer:    j.opts.issuer,
+		Audience:  j.opts.audience,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(ttl).Unix(),
+		Values:    s.Values,
+		CreatedAt: s.CreatedAt,
+		LastSeen:  s.LastSeen,
+		Deadline:  s.ExpiresAt,
+		Metadata:  s.Metadata,
+		Version:   s.Version + 1,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	input := header + "." + claims
+	sig, err := key.sign([]byte(input))
+	if err != nil {
+		return "", err
+	}
+
+	token := input + "." + base64.RawURLEncoding.EncodeToString(sig)
+	if len(token) > maxCookieSize {
+		return "", ErrTokenTooLarge
+	}
+	s.Version++
+	return token, nil
+}
+
+// Delete implements Store, session id of token is kept in denylist until absolute expiry of
+// session since tokens issued later for the same session expire after this one
+func (j *JWTStore) Delete(ctx context.Context, token string) error {
+	if j.opts.denylist == nil {
+		return nil
+	}
+
+	claims, err := j.parse(token)
+	if err != nil {
+		return err
+	}
+	until := time.Unix(claims.ExpiresAt, 0)
+	if claims.Deadline.After(until) {
+		until = claims.Deadline
+	}
+	ttl := time.Until(until) + j.opts.leeway
+	if ttl <= 0 {
+		return nil
+	}
+	return j.opts.denylist.Set(ctx, j.opts.prefix+claims.ID, "1", ttl)
+}
@@ -0,0 +1,131 @@
+package session
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-tire/pkg/kv"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJWTStore(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+
+	keys := []SigningKey{
+		{ID: "hs", Algorithm: HS256, Secret: []byte("0123456789abcdef")},
+		{ID: "rs", Algorithm: RS256, PrivateKey: rsaKey},
+		{ID: "ed", Algorithm: EdDSA, PrivateKey: edKey},
+	}
+	for _, k := range keys {
+		st, err := NewJWTStore([]SigningKey{k}, JWTIssuer("test"))
+		assert.Nil(t, err)
+		testStore(t, NewManager(WithStore(st)))
+	}
+
+	_, err = NewJWTStore(nil)
+	assert.NotNil(t, err)
+	_, err = NewJWTStore([]SigningKey{{ID: "bad", Algorithm: RS256, PrivateKey: edKey}})
+	assert.NotNil(t, err)
+	_, err = NewJWTStore([]SigningKey{{ID: "none", Algorithm: "none"}})
+	assert.NotNil(t, err)
+}
+
+func TestJWTStoreRotation(t *testing.T) {
+	ctx := context.Background()
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	st, err := NewJWTStore([]SigningKey{{ID: "k1", Algorithm: EdDSA, PrivateKey: edKey}})
+	assert.Nil(t, err)
+	s := &Session{ID: "id", UserID: "u1"}
+	assert.Nil(t, s.Set("a", 1))
+	old, err := st.Save(ctx, s, time.Minute)
+	assert.Nil(t, err)
+
+	assert.Nil(t, st.Rotate(SigningKey{ID: "k2", Algorithm: HS256, Secret: []byte("0123456789abcdef")}))
+	token, err := st.Save(ctx, s, time.Minute)
+	assert.Nil(t, err)
+	assert.NotEqual(t, old, token)
+
+	for _, tk := range []string{old, token} {
+		loaded, err := st.Load(ctx, tk)
+		assert.Nil(t, err)
+		assert.Equal(t, "u1", loaded.UserID)
+	}
+
+	// verify only keys can not sign
+	verifier, err := NewJWTStore([]SigningKey{{ID: "k1", Algorithm: EdDSA, PublicKey: edKey.Public()}})
+	assert.Nil(t, err)
+	_, err = verifier.Load(ctx, old)
+	assert.Nil(t, err)
+	_, err = verifier.Save(ctx, s, time.Minute)
+	assert.NotNil(t, err)
+
+	// tampered claims
+	parts := strings.Split(token, ".")
+	claims, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	parts[1] = base64.RawURLEncoding.EncodeToString([]byte(strings.Replace(string(claims), "u1", "u2", 1)))
+	_, err = st.Load(ctx, strings.Join(parts, "."))
+	assert.Equal(t, ErrInvalidToken, err)
+
+	// algorithm must match key
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT","kid":"k1"}`))
+	_, err = st.Load(ctx, header+"."+strings.Split(old, ".")[1]+".")
+	assert.Equal(t, ErrInvalidToken, err)
+
+	// other issuer
+	other, _ := NewJWTStore([]SigningKey{{ID: "k1", Algorithm: EdDSA, PrivateKey: edKey}}, JWTIssuer("other"))
+	_, err = other.Load(ctx, old)
+	assert.Equal(t, ErrInvalidToken, err)
+
+	// expired
+	expired, err := st.Save(ctx, s, -time.Minute)
+	assert.Nil(t, err)
+	_, err = st.Load(ctx, expired)
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestJWTStoreDenylist(t *testing.T) {
+	ctx := context.Background()
+	denylist := kv.NewInMemory(ctx).Store()
+
+	st, err := NewJWTStore([]SigningKey{{ID: "k1", Algorithm: HS256, Secret: []byte("0123456789abcdef")}},
+		JWTDenylist(denylist, "revoked:"))
+	assert.Nil(t, err)
+	m := NewManager(WithStore(st))
+
+	s, err := m.New(ctx)
+	assert.Nil(t, err)
+	assert.Nil(t, s.Set("a", 1))
+	assert.Nil(t, m.Save(ctx, s))
+	token := s.Token()
+
+	loaded, err := m.Load(ctx, token)
+	assert.Nil(t, err)
+	assert.Nil(t, m.Destroy(ctx, loaded))
+	_, err = m.Load(ctx, token)
+	assert.Equal(t, ErrNotFound, err)
+
+	v, err := denylist.Get(ctx, "revoked:"+s.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "1", v)
+
+	// revoking an older token also revokes tokens issued later for the session
+	s, err = m.New(ctx)
+	assert.Nil(t, err)
+	older, err := st.Save(ctx, s, time.Nanosecond)
+	assert.Nil(t, err)
+	newer, err := st.Save(ctx, s, time.Hour)
+	assert.Nil(t, err)
+	assert.Nil(t, st.Delete(ctx, older))
+	_, err = st.Load(ctx, newer)
+	assert.Equal(t, ErrNotFound, err)
+}
@@ -0,0 +1,184 @@
+package session
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// ErrTampered is returned when stored session can not be decrypted or its integrity check fails
+var ErrTampered = errors.New("session: integrity check failed")
+
+// minSecretSize is minimum size of a keyring secret
+const minSecretSize = 16
+
+// Key is a secret used to encrypt and sign sessions, ID is stored next to encrypted data
+// to find the key on decryption so it should be unique and must not contain ':'
+type Key struct {
+	ID     string
+	Secret []byte
+}
+
+type derivedKey struct {
+	id   string
+	aead cipher.AEAD
+	mac  []byte
+}
+
+// Keyring holds keys used to encrypt and sign stored sessions, the newest key encrypts and
+// all keys can decrypt so keys can be rotated without invalidating existing sessions
+type Keyring struct {
+	lock sync.RWMutex
+	keys []*derivedKey
+}
+
+// NewKeyring returns a keyring of given keys, first key is the newest one
+func NewKeyring(keys ...Key) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("session: keyring needs at least one key")
+	}
+
+	kr := &Keyring{}
+	for i := len(keys) - 1; i >= 0; i-- {
+		if err := kr.Rotate(keys[i]); err != nil {
+			return nil, err
+		}
+	}
+	return kr, nil
+}
+
+// derive returns a sub key of secret for given purpose, so a secret is never used
+// for both encryption and signing
+func derive(secret []byte, purpose string) []byte {
+	h := hmac.New(sha256.New, secret)
+	_, _ = h.Write([]byte(purpose))
+	return h.Sum(nil)
+}
+
+// Rotate add k as the newest key, old keys are still used to decrypt
+func (kr *Keyring) Rotate(k Key) error {
+	if k.ID == "" || strings.Contains(k.ID, ":") {
+		return fmt.Errorf("session: invalid key id %q", k.ID)
+	}
+	if len(k.Secret) < minSecretSize {
+		return fmt.Errorf("session: key %q is shorter than %d bytes", k.ID, minSecretSize)
+	}
+
+	block, err := aes.NewCipher(derive(k.Secret, "session-encryption"))
+	if err != nil {
+		return err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+
+	kr.lock.Lock()
+	defer kr.lock.Unlock()
+	for _, dk := range kr.keys {
+		if dk.id == k.ID {
+			return fmt.Errorf("session: duplicate key id %q", k.ID)
+		}
+	}
+	kr.keys = append([]*derivedKey{{id: k.ID, aead: aead, mac: derive(k.Secret, "session-integrity")}}, kr.keys...)
+	return nil
+}
+
+// Remove drop a retired key, sessions encrypted with it can not be loaded anymore
+func (kr *Keyring) Remove(id string) {
+	kr.lock.Lock()
+	defer kr.lock.Unlock()
+
+	for i, dk := range kr.keys {
+		if dk.id == id && len(kr.keys) > 1 {
+			kr.keys = append(kr.keys[:i:i], kr.keys[i+1:]...)
+			return
+		}
+	}
+}
+
+func (kr *Keyring) primary() *derivedKey {
+	kr.lock.RLock()
+	defer kr.lock.RUnlock()
+	return kr.keys[0]
+}
+
+func (kr *Keyring) find(id string) *derivedKey {
+	kr.lock.RLock()
+	defer kr.lock.RUnlock()
+
+	for _, dk := range kr.keys {
+		if dk.id == id {
+			return dk
+		}
+	}
+	return nil
+}
+
+// split parse a "<key id>:<base64 data>" string
+func (kr *Keyring) split(s string) (*derivedKey, []byte, error) {
+	i := strings.IndexByte(s, ':')
+	if i < 0 {
+		return nil, nil, ErrTampered
+	}
+	dk := kr.find(s[:i])
+	if dk == nil {
+		return nil, nil, ErrTampered
+	}
+	data, err := base64.RawStdEncoding.DecodeString(s[i+1:])
+	if err != nil {
+		return nil, nil, ErrTampered
+	}
+	return dk, data, nil
+}
+
+// seal encrypt plaintext with the newest key, aad binds ciphertext to where it's stored
+func (kr *Keyring) seal(plaintext, aad []byte) (string, error) {
+	dk := kr.primary()
+	nonce := make([]byte, dk.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return dk.id + ":" + base64.RawStdEncoding.EncodeToString(dk.aead.Seal(nonce, nonce, plaintext, aad)), nil
+}
+
+func (kr *Keyring) open(sealed string, aad []byte) ([]byte, error) {
+	dk, data, err := kr.split(sealed)
+	if err != nil {
+		return nil, err
+	}
+	ns := dk.aead.NonceSize()
+	if len(data) < ns {
+		return nil, ErrTampered
+	}
+	plaintext, err := dk.aead.Open(nil, data[:ns], data[ns:], aad)
+	if err != nil {
+		return nil, ErrTampered
+	}
+	return plaintext, nil
+}
+
+// sign returns HMAC-SHA256 of data using the newest key
+func (kr *Keyring) sign(data []byte) string {
+	dk := kr.primary()
+	h := hmac.New(sha256.New, dk.mac)
+	_, _ = h.Write(data)
+	return dk.id + ":" + base64.RawStdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func (kr *Keyring) verify(data []byte, sig string) bool {
+	dk, mac, err := kr.split(sig)
+	if err != nil {
+		return false
+	}
+	h := hmac.New(sha256.New, dk.mac)
+	_, _ = h.Write(data)
+	return hmac.Equal(mac, h.Sum(nil))
+}
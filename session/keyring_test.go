@@ -0,0 +1,115 @@
+package session
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/golang-tire/pkg/kv"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyring(t *testing.T) {
+	_, err := NewKeyring()
+	assert.NotNil(t, err)
+	_, err = NewKeyring(Key{ID: "a:b", Secret: []byte("0123456789abcdef")})
+	assert.NotNil(t, err)
+	_, err = NewKeyring(Key{ID: "k1", Secret: []byte("short")})
+	assert.NotNil(t, err)
+	_, err = NewKeyring(Key{ID: "k1", Secret: []byte("0123456789abcdef")}, Key{ID: "k1", Secret: []byte("0123456789abcdef")})
+	assert.NotNil(t, err)
+
+	kr, err := NewKeyring(Key{ID: "k1", Secret: []byte("0123456789abcdef")})
+	assert.Nil(t, err)
+
+	sealed, err := kr.seal([]byte("secret"), []byte("aad"))
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(sealed, "k1:"))
+	sig := kr.sign([]byte("data"))
+
+	// newest key encrypts, old keys still decrypt
+	assert.Nil(t, kr.Rotate(Key{ID: "k2", Secret: []byte("fedcba9876543210")}))
+	newSealed, err := kr.seal([]byte("secret"), []byte("aad"))
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(newSealed, "k2:"))
+
+	plain, err := kr.open(sealed, []byte("aad"))
+	assert.Nil(t, err)
+	assert.Equal(t, "secret", string(plain))
+	assert.True(t, kr.verify([]byte("data"), sig))
+	assert.False(t, kr.verify([]byte("other"), sig))
+
+	_, err = kr.open(sealed, []byte("other"))
+	assert.Equal(t, ErrTampered, err)
+
+	kr.Remove("k1")
+	_, err = kr.open(sealed, []byte("aad"))
+	assert.Equal(t, ErrTampered, err)
+}
+
+func TestEncryptedStore(t *testing.T) {
+	ctx := context.Background()
+	kr, err := NewKeyring(Key{ID: "k1", Secret: []byte("0123456789abcdef")})
+	assert.Nil(t, err)
+
+	m := NewManager(KeyPrefix("encrypted:"), WithKeyring(kr))
+	testStore(t, m)
+
+	s, err := m.New(ctx)
+	assert.Nil(t, err)
+	s.Metadata.IP = "1.2.3.4"
+	assert.Nil(t, s.Set("token", "top-secret"))
+	assert.Nil(t, m.Save(ctx, s))
+
+	raw, err := kv.Get().Redis().HGetAll(ctx, "encrypted:"+s.ID).Result()
+	assert.Nil(t, err)
+	for _, v := range raw {
+		assert.NotContains(t, v, "top-secret")
+		assert.NotContains(t, v, "1.2.3.4")
+	}
+
+	assert.Nil(t, kr.Rotate(Key{ID: "k2", Secret: []byte("fedcba9876543210")}))
+	loaded, err := m.Load(ctx, s.ID)
+	assert.Nil(t, err)
+	var token string
+	assert.Nil(t, loaded.Get("token", &token))
+	assert.Equal(t, "top-secret", token)
+	assert.Equal(t, "1.2.3.4", loaded.Metadata.IP)
+
+	// values can not be moved between fields or sessions
+	assert.Nil(t, kv.Get().Redis().HSet(ctx, "encrypted:"+s.ID, "v:other", raw["v:token"]).Err())
+	_, err = m.Load(ctx, s.ID)
+	assert.Equal(t, ErrTampered, err)
+
+	// fields can not be removed, replayed or have their versions changed
+	rdb, key := kv.Get().Redis(), "encrypted:"+s.ID
+	assert.Nil(t, rdb.HDel(ctx, key, "v:other").Err())
+	_, err = m.Load(ctx, s.ID)
+	assert.Nil(t, err)
+
+	assert.Nil(t, loaded.Set("token", "rotated"))
+	assert.Nil(t, m.Save(ctx, loaded))
+	current, err := rdb.HGetAll(ctx, key).Result()
+	assert.Nil(t, err)
+	assert.Nil(t, rdb.HDel(ctx, key, "v:token").Err())
+	_, err = m.Load(ctx, s.ID)
+	assert.Equal(t, ErrTampered, err)
+	assert.Nil(t, rdb.HSet(ctx, key, "v:token", raw["v:token"]).Err())
+	_, err = m.Load(ctx, s.ID)
+	assert.Equal(t, ErrTampered, err)
+	assert.Nil(t, rdb.HSet(ctx, key, "v:token", current["v:token"]).Err())
+	_, err = m.Load(ctx, s.ID)
+	assert.Nil(t, err)
+	assert.Nil(t, rdb.HSet(ctx, key, "_version", 1).Err())
+	_, err = m.Load(ctx, s.ID)
+	assert.Equal(t, ErrTampered, err)
+	assert.Nil(t, rdb.HSet(ctx, key, "_version", current["_version"], "r:token", 5).Err())
+	_, err = m.Load(ctx, s.ID)
+	assert.Equal(t, ErrTampered, err)
+	assert.Equal(t, ErrTampered, m.Save(ctx, loaded))
+
+	// a new session is created instead of failing the request
+	s, err = m.loadOrNew(ctx, s.ID, Metadata{})
+	assert.Nil(t, err)
+	assert.True(t, s.IsNew())
+}
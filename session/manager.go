@@ -0,0 +1,506 @@
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-tire/pkg/kv"
+	"github.com/golang-tire/pkg/log"
+)
+
+var (
+	// ErrNotFound is returned when a session does not exist or it is expired
+	ErrNotFound = errors.New("session: not found")
+
+	// ErrNoStore is returned when manager has no storage to use
+	ErrNoStore = errors.New("session: no store configured")
+)
+
+// idBytes is number of random bytes in a session id
+const idBytes = 32
+
+type managerOptions struct {
+	cookieName   string
+	cookiePath   string
+	cookieDomain string
+	secure       bool
+	httpOnly     bool
+	sameSite     http.SameSite
+	idleTimeout  time.Duration
+	maxLifetime  time.Duration
+	keyPrefix    string
+	authScheme   string
+	metadataKey  string
+	trustProxy   bool
+	store        Store
+	client       *kv.Client
+	keyring      *Keyring
+	listeners    []Listener
+
+	configureNotifications bool
+}
+
+// A ManagerOption sets options such as cookie attributes and expiry of session manager
+type ManagerOption interface {
+	apply(*managerOptions)
+}
+
+// funcManagerOption wraps a function that modifies managerOptions into an
+// implementation of the ManagerOption interface.
+type funcManagerOption struct {
+	f func(*managerOptions)
+}
+
+func (fmo *funcManagerOption) apply(mo *managerOptions) {
+	fmo.f(mo)
+}
+
+func newFuncManagerOption(f func(*managerOptions)) *funcManagerOption {
+	return &funcManagerOption{
+		f: f,
+	}
+}
+
+// CookieName returns a ManagerOption that set session cookie name
+func CookieName(name string) ManagerOption {
+	return newFuncManagerOption(func(o *managerOptions) {
+		o.cookieName = name
+	})
+}
+
+// CookiePath returns a ManagerOption that set session cookie path
+func CookiePath(path string) ManagerOption {
+	return newFuncManagerOption(func(o *managerOptions) {
+		o.cookiePath = path
+	})
+}
+
+// CookieDomain returns a ManagerOption that set session cookie domain
+func CookieDomain(domain string) ManagerOption {
+	return newFuncManagerOption(func(o *managerOptions) {
+		o.cookieDomain = domain
+	})
+}
+
+// Secure returns a ManagerOption that set Secure attribute of session cookie, default is true
+func Secure(b bool) ManagerOption {
+	return newFuncManagerOption(func(o *managerOptions) {
+		o.secure = b
+	})
+}
+
+// HTTPOnly returns a ManagerOption that set HttpOnly attribute of session cookie, default is true
+func HTTPOnly(b bool) ManagerOption {
+	return newFuncManagerOption(func(o *managerOptions) {
+		o.httpOnly = b
+	})
+}
+
+// SameSite returns a ManagerOption that set SameSite attribute of session cookie, default is lax
+func SameSite(s http.SameSite) ManagerOption {
+	return newFuncManagerOption(func(o *managerOptions) {
+		o.sameSite = s
+	})
+}
+
+// IdleTimeout returns a ManagerOption that set how long a session lives without activity
+func IdleTimeout(d time.Duration) ManagerOption {
+	return newFuncManagerOption(func(o *managerOptions) {
+		o.idleTimeout = d
+	})
+}
+
+// MaxLifetime returns a ManagerOption that set absolute lifetime of a session
+func MaxLifetime(d time.Duration) ManagerOption {
+	return newFuncManagerOption(func(o *managerOptions) {
+		o.maxLifetime = d
+	})
+}
+
+// KeyPrefix returns a ManagerOption that set prefix of session keys in kv when default store is used
+func KeyPrefix(p string) ManagerOption {
+	return newFuncManagerOption(func(o *managerOptions) {
+		o.keyPrefix = p
+	})
+}
+
+// AuthScheme returns a ManagerOption that set Authorization header scheme used to
+// send session id, default is "Session" e.g. "Authorization: Session <id>"
+func AuthScheme(scheme string) ManagerOption {
+	return newFuncManagerOption(func(o *managerOptions) {
+		o.authScheme = scheme
+	})
+}
+
+// MetadataKey returns a ManagerOption that set grpc metadata key used to send and
+// receive session id, default is "session-id"
+func MetadataKey(key string) ManagerOption {
+	return newFuncManagerOption(func(o *managerOptions) {
+		o.metadataKey = key
+	})
+}
+
+// TrustProxyHeaders returns a ManagerOption that use X-Forwarded-For header as client ip,
+// it should only be enabled behind a trusted proxy
+func TrustProxyHeaders(b bool) ManagerOption {
+	return newFuncManagerOption(func(o *managerOptions) {
+		o.trustProxy = b
+	})
+}
+
+// WithClient returns a ManagerOption that store sessions in redis using given kv client
+func WithClient(c *kv.Client) ManagerOption {
+	return newFuncManagerOption(func(o *managerOptions) {
+		o.client = c
+	})
+}
+
+// WithKeyring returns a ManagerOption that encrypt sessions of default redis store using given keyring
+func WithKeyring(kr *Keyring) ManagerOption {
+	return newFuncManagerOption(func(o *managerOptions) {
+		o.keyring = kr
+	})
+}
+
+// WithStore returns a ManagerOption that set session store, default is a redis store
+// that use client of WithClient or kv.Get(). Sessions are indexed by user only if store
+// implements Indexer
+func WithStore(st Store) ManagerOption {
+	return newFuncManagerOption(func(o *managerOptions) {
+		o.store = st
+	})
+}
+
+// Manager create, load and persist sessions and handle session cookies
+type Manager struct {
+	opts managerOptions
+}
+
+// NewManager create a new session manager
+func NewManager(opts ...ManagerOption) *Manager {
+	o := managerOptions{
+		cookieName:  "session_id",
+		cookiePath:  "/",
+		secure:      true,
+		httpOnly:    true,
+		sameSite:    http.SameSiteLaxMode,
+		idleTimeout: 30 * time.Minute,
+		maxLifetime: 24 * time.Hour,
+		keyPrefix:   "session:",
+		authScheme:  "Session",
+		metadataKey: "session-id",
+	}
+	for _, opt := range opts {
+		opt.apply(&o)
+	}
+
+	m := &Manager{opts: o}
+	if n, ok := o.store.(expiryNotifier); ok {
+		n.onExpired(m.expired)
+	}
+	return m
+}
+
+func (m *Manager) store() (Store, error) {
+	if m.opts.store != nil {
+		return m.opts.store, nil
+	}
+	c := m.client()
+	if c == nil {
+		return nil, ErrNoStore
+	}
+	return NewRedisStore(c, m.opts.keyPrefix, Encrypt(m.opts.keyring)), nil
+}
+
+func (m *Manager) client() *kv.Client {
+	if m.opts.client != nil {
+		return m.opts.client
+	}
+	return kv.Get()
+}
+
+// newID generate a cryptographically random session id
+func newID() (string, error) {
+	b := make([]byte, idBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// New create a new session, it will not be stored until Save is called
+func (m *Manager) New(ctx context.Context) (*Session, error) {
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return &Session{
+		ID:        id,
+		Values:    make(map[string]json.RawMessage),
+		CreatedAt: now,
+		LastSeen:  now,
+		ExpiresAt: now.Add(m.opts.maxLifetime),
+		isNew:     true,
+	}, nil
+}
+
+// Load read a session by its token, which is the session id for server side stores,
+// it returns ErrNotFound if session does not exist or it is expired
+func (m *Manager) Load(ctx context.Context, token string) (*Session, error) {
+	st, err := m.store()
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := st.Load(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if now.After(s.ExpiresAt) || now.Sub(s.LastSeen) > m.opts.idleTimeout {
+		_ = st.Delete(ctx, token)
+		m.emit(ctx, EventExpired, s.ID, s.UserID)
+		return nil, ErrNotFound
+	}
+	s.token = token
+	return s, nil
+}
+
+// ttl returns how long session should be kept from now, it's idle timeout but never
+// pass the absolute expiry
+func (m *Manager) ttl(s *Session, now time.Time) time.Duration {
+	ttl := m.opts.idleTimeout
+	if left := s.ExpiresAt.Sub(now); left < ttl {
+		ttl = left
+	}
+	return ttl
+}
+
+// Save store session and extend its expiry by idle timeout (sliding expiration), it returns
+// ErrConflict if store detects a field changed by session is changed by another request
+// and ErrNotFound if session is removed since it's loaded
+func (m *Manager) Save(ctx context.Context, s *Session) error {
+	st, err := m.store()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ttl := m.ttl(s, now)
+	if ttl <= 0 {
+		return ErrNotFound
+	}
+
+	s.LastSeen = now
+	created := s.isNew
+	token, err := st.Save(ctx, s, ttl)
+	if err != nil {
+		return err
+	}
+
+	if s.oldToken != "" && s.oldToken != token {
+		if err := st.Delete(ctx, s.oldToken); err != nil {
+			return err
+		}
+	}
+	// client side stores do not use session id as token and can not be looked up by id
+	if token == s.ID {
+		if err := m.index(ctx, s.UserID, s.ID, s.ExpiresAt); err != nil {
+			return err
+		}
+	}
+	if s.oldID != "" && s.oldID != s.ID {
+		if err := m.unindex(ctx, s.UserID, s.oldID); err != nil {
+			return err
+		}
+	}
+	s.oldID = ""
+	s.oldToken = ""
+	s.changed = nil
+	s.token = token
+	s.isNew = false
+	s.dirty = false
+
+	if created {
+		m.emit(ctx, EventCreated, s.ID, s.UserID)
+	} else {
+		m.emit(ctx, EventRefreshed, s.ID, s.UserID)
+	}
+	return nil
+}
+
+// maxUpdateAttempts is number of times Update retries on conflict
+const maxUpdateAttempts = 3
+
+// Update load session of token, apply fn and save it, fn is called again with a freshly loaded
+// session if another request changed the same fields in between
+func (m *Manager) Update(ctx context.Context, token string, fn func(*Session) error) error {
+	var err error
+	for i := 0; i < maxUpdateAttempts; i++ {
+		var s *Session
+		if s, err = m.Load(ctx, token); err != nil {
+			return err
+		}
+		if err = fn(s); err != nil {
+			return err
+		}
+		if err = m.Save(ctx, s); err != ErrConflict {
+			return err
+		}
+	}
+	return err
+}
+
+// Regenerate assign a new id to session, old id is removed on next Save. It should be
+// called on login or privilege change to prevent session fixation
+func (m *Manager) Regenerate(ctx context.Context, s *Session) error {
+	id, err := newID()
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if !s.isNew && s.oldToken == "" {
+		s.oldToken = s.token
+		s.oldID = s.ID
+	}
+	s.ID = id
+	// all values are written to the new id
+	s.versions = nil
+	for k := range s.Values {
+		s.markChanged(k)
+	}
+	s.dirty = true
+	return nil
+}
+
+// Destroy remove session from store
+func (m *Manager) Destroy(ctx context.Context, s *Session) error {
+	st, err := m.store()
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, token := range []string{s.token, s.oldToken} {
+		if token == "" {
+			continue
+		}
+		if err := st.Delete(ctx, token); err != nil {
+			return err
+		}
+	}
+	if err := m.unindex(ctx, s.UserID, s.ID, s.oldID); err != nil {
+		return err
+	}
+	s.destroyed = true
+	m.emit(ctx, EventRevoked, s.ID, s.UserID)
+	return nil
+}
+
+// needsSave check if session is changed or its expiry should be extended
+func (m *Manager) needsSave(s *Session) bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if s.destroyed {
+		return false
+	}
+	if s.dirty {
+		return true
+	}
+	// refresh sliding expiry of active sessions without writing on every request
+	return !s.isNew && time.Since(s.LastSeen) > m.opts.idleTimeout/10
+}
+
+// loadOrNew load session by id or create a new one with given client metadata if there is no valid session
+func (m *Manager) loadOrNew(ctx context.Context, id string, meta Metadata) (*Session, error) {
+	if id != "" {
+		s, err := m.Load(ctx, id)
+		switch err {
+		case nil:
+			return s, nil
+		case ErrTampered, ErrInvalidToken:
+			log.Error("session: rejected invalid session", log.Err(err))
+		case ErrNotFound:
+		default:
+			return nil, err
+		}
+	}
+
+	s, err := m.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.Metadata = meta
+	return s, nil
+}
+
+// FromRequest load session of request cookie or Authorization header,
+// or create a new one if there is no valid session
+func (m *Manager) FromRequest(r *http.Request) (*Session, error) {
+	return m.loadOrNew(r.Context(), m.idFromRequest(r), m.metadataFromRequest(r))
+}
+
+func (m *Manager) idFromRequest(r *http.Request) string {
+	if c, err := r.Cookie(m.opts.cookieName); err == nil && c.Value != "" {
+		return c.Value
+	}
+	return m.idFromAuthorization(r.Header.Get("Authorization"))
+}
+
+func (m *Manager) idFromAuthorization(v string) string {
+	prefix := m.opts.authScheme + " "
+	if len(v) > len(prefix) && strings.EqualFold(v[:len(prefix)], prefix) {
+		return strings.TrimSpace(v[len(prefix):])
+	}
+	return ""
+}
+
+// WriteCookie set session cookie on response, cookie expires with session absolute expiry
+func (m *Manager) WriteCookie(w http.ResponseWriter, s *Session) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     m.opts.cookieName,
+		Value:    s.token,
+		Path:     m.opts.cookiePath,
+		Domain:   m.opts.cookieDomain,
+		Expires:  s.ExpiresAt,
+		Secure:   m.opts.secure,
+		HttpOnly: m.opts.httpOnly,
+		SameSite: m.opts.sameSite,
+	})
+}
+
+// ClearCookie remove session cookie from client
+func (m *Manager) ClearCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     m.opts.cookieName,
+		Value:    "",
+		Path:     m.opts.cookiePath,
+		Domain:   m.opts.cookieDomain,
+		MaxAge:   -1,
+		Expires:  time.Unix(0, 0),
+		Secure:   m.opts.secure,
+		HttpOnly: m.opts.httpOnly,
+		SameSite: m.opts.sameSite,
+	})
+}
@@ -0,0 +1,130 @@
+package session
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManager(t *testing.T) {
+	ctx := context.Background()
+	m := NewManager()
+
+	s, err := m.New(ctx)
+	assert.Nil(t, err)
+	assert.True(t, s.IsNew())
+	assert.Len(t, s.ID, 43)
+
+	assert.Nil(t, s.Set("user", "john"))
+	assert.Nil(t, s.Set("roles", []string{"admin"}))
+	assert.True(t, s.Dirty())
+	assert.Nil(t, m.Save(ctx, s))
+	assert.False(t, s.IsNew())
+	assert.False(t, s.Dirty())
+
+	loaded, err := m.Load(ctx, s.ID)
+	assert.Nil(t, err)
+	var user string
+	assert.Nil(t, loaded.Get("user", &user))
+	assert.Equal(t, "john", user)
+	var roles []string
+	assert.Nil(t, loaded.Get("roles", &roles))
+	assert.Equal(t, []string{"admin"}, roles)
+	assert.Equal(t, ErrKeyNotFound, loaded.Get("missing", &user))
+	assert.ElementsMatch(t, []string{"user", "roles"}, loaded.Keys())
+
+	loaded.Delete("roles")
+	assert.True(t, loaded.Dirty())
+
+	// regenerate on login
+	oldID := loaded.ID
+	assert.Nil(t, m.Regenerate(ctx, loaded))
+	assert.NotEqual(t, oldID, loaded.ID)
+	assert.Nil(t, m.Save(ctx, loaded))
+	_, err = m.Load(ctx, oldID)
+	assert.Equal(t, ErrNotFound, err)
+	loaded, err = m.Load(ctx, loaded.ID)
+	assert.Nil(t, err)
+	assert.Nil(t, loaded.Get("user", &user))
+
+	assert.Nil(t, m.Destroy(ctx, loaded))
+	_, err = m.Load(ctx, loaded.ID)
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestManagerExpiry(t *testing.T) {
+	ctx := context.Background()
+
+	// idle timeout
+	m := NewManager(IdleTimeout(50*time.Millisecond), MaxLifetime(time.Hour))
+	s, err := m.New(ctx)
+	assert.Nil(t, err)
+	assert.Nil(t, m.Save(ctx, s))
+
+	time.Sleep(30 * time.Millisecond)
+	s, err = m.Load(ctx, s.ID)
+	assert.Nil(t, err)
+	assert.Nil(t, m.Save(ctx, s))
+
+	// activity extended idle timeout
+	time.Sleep(30 * time.Millisecond)
+	s, err = m.Load(ctx, s.ID)
+	assert.Nil(t, err)
+
+	time.Sleep(60 * time.Millisecond)
+	_, err = m.Load(ctx, s.ID)
+	assert.Equal(t, ErrNotFound, err)
+
+	// absolute lifetime
+	m = NewManager(IdleTimeout(time.Hour), MaxLifetime(50*time.Millisecond))
+	s, err = m.New(ctx)
+	assert.Nil(t, err)
+	assert.Nil(t, m.Save(ctx, s))
+	time.Sleep(60 * time.Millisecond)
+	_, err = m.Load(ctx, s.ID)
+	assert.Equal(t, ErrNotFound, err)
+	assert.Equal(t, ErrNotFound, m.Save(ctx, s))
+}
+
+func TestManagerCookies(t *testing.T) {
+	ctx := context.Background()
+	m := NewManager(CookieName("sid"), CookieDomain("example.com"), SameSite(http.SameSiteStrictMode))
+
+	s, err := m.New(ctx)
+	assert.Nil(t, err)
+	assert.Nil(t, m.Save(ctx, s))
+
+	w := httptest.NewRecorder()
+	m.WriteCookie(w, s)
+	cookies := w.Result().Cookies()
+	assert.Len(t, cookies, 1)
+	c := cookies[0]
+	assert.Equal(t, "sid", c.Name)
+	assert.Equal(t, s.ID, c.Value)
+	assert.Equal(t, "example.com", c.Domain)
+	assert.True(t, c.Secure)
+	assert.True(t, c.HttpOnly)
+	assert.Equal(t, http.SameSiteStrictMode, c.SameSite)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(c)
+	loaded, err := m.FromRequest(r)
+	assert.Nil(t, err)
+	assert.Equal(t, s.ID, loaded.ID)
+	assert.False(t, loaded.IsNew())
+
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: "sid", Value: "unknown"})
+	fresh, err := m.FromRequest(r)
+	assert.Nil(t, err)
+	assert.True(t, fresh.IsNew())
+	assert.NotEqual(t, "unknown", fresh.ID)
+
+	w = httptest.NewRecorder()
+	m.ClearCookie(w)
+	assert.Equal(t, -1, w.Result().Cookies()[0].MaxAge)
+}
@@ -0,0 +1,93 @@
+package session
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// metadataFromRequest capture client metadata of http request
+func (m *Manager) metadataFromRequest(r *http.Request) Metadata {
+	ip := hostOnly(r.RemoteAddr)
+	if m.opts.trustProxy {
+		if fwd := forwardedFor(r.Header.Get("X-Forwarded-For")); fwd != "" {
+			ip = fwd
+		}
+	}
+
+	ua := r.UserAgent()
+	return Metadata{
+		IP:        ip,
+		UserAgent: ua,
+		Device:    deviceFromUserAgent(ua),
+	}
+}
+
+// metadataFromContext capture client metadata of grpc call, requests forwarded by grpc-gateway
+// carry the original user agent and client address
+func (m *Manager) metadataFromContext(ctx context.Context) Metadata {
+	var meta Metadata
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		meta.IP = hostOnly(p.Addr.String())
+	}
+
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return meta
+	}
+
+	if m.opts.trustProxy {
+		if v := md.Get("x-forwarded-for"); len(v) > 0 {
+			if fwd := forwardedFor(v[0]); fwd != "" {
+				meta.IP = fwd
+			}
+		}
+	}
+
+	for _, key := range []string{"grpcgateway-user-agent", "user-agent"} {
+		if v := md.Get(key); len(v) > 0 && v[0] != "" {
+			meta.UserAgent = v[0]
+			break
+		}
+	}
+	meta.Device = deviceFromUserAgent(meta.UserAgent)
+	return meta
+}
+
+func hostOnly(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// forwardedFor returns the client address of X-Forwarded-For header
+func forwardedFor(v string) string {
+	if i := strings.IndexByte(v, ','); i >= 0 {
+		v = v[:i]
+	}
+	return strings.TrimSpace(v)
+}
+
+// deviceFromUserAgent returns a rough device class of user agent
+func deviceFromUserAgent(ua string) string {
+	if ua == "" {
+		return ""
+	}
+
+	l := strings.ToLower(ua)
+	switch {
+	case strings.Contains(l, "ipad") || strings.Contains(l, "tablet"):
+		return "tablet"
+	case strings.Contains(l, "mobi") || strings.Contains(l, "iphone") || strings.Contains(l, "android"):
+		return "mobile"
+	case strings.Contains(l, "windows") || strings.Contains(l, "macintosh") || strings.Contains(l, "linux") || strings.Contains(l, "x11"):
+		return "desktop"
+	}
+	return "other"
+}
@@ -0,0 +1,240 @@
+package session
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/golang-tire/pkg/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+type ctxKey struct{}
+
+// NewContext returns a new context that carry session
+func NewContext(ctx context.Context, s *Session) context.Context {
+	return context.WithValue(ctx, ctxKey{}, s)
+}
+
+// FromContext returns session stored in context by middlewares, or nil if there is no session
+func FromContext(ctx context.Context) *Session {
+	s, _ := ctx.Value(ctxKey{}).(*Session)
+	return s
+}
+
+// Middleware is an HTTP middleware that load session of request into context and
+// persist it before response is written if it's changed
+func (m *Manager) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s, err := m.FromRequest(r)
+		if err != nil {
+			log.Error("session: load failed", log.Err(err))
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		sw := &sessionWriter{ResponseWriter: w, manager: m, request: r, session: s}
+		next.ServeHTTP(sw, r.WithContext(NewContext(r.Context(), s)))
+		sw.commit()
+	})
+}
+
+// sessionWriter persist session and write its cookie right before response headers are sent
+type sessionWriter struct {
+	http.ResponseWriter
+	manager   *Manager
+	request   *http.Request
+	session   *Session
+	committed bool
+}
+
+func (w *sessionWriter) commit() {
+	if w.committed {
+		return
+	}
+	w.committed = true
+
+	s := w.session
+	s.lock.RLock()
+	destroyed := s.destroyed
+	s.lock.RUnlock()
+
+	if destroyed {
+		w.manager.ClearCookie(w.ResponseWriter)
+		return
+	}
+	if !w.manager.needsSave(s) {
+		return
+	}
+	if err := w.manager.Save(w.request.Context(), s); err != nil {
+		log.Error("session: save failed", log.String("id", s.ID), log.Err(err))
+		return
+	}
+	w.manager.WriteCookie(w.ResponseWriter, s)
+}
+
+// WriteHeader implements http.ResponseWriter
+func (w *sessionWriter) WriteHeader(code int) {
+	w.commit()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write implements http.ResponseWriter
+func (w *sessionWriter) Write(b []byte) (int, error) {
+	w.commit()
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher
+func (w *sessionWriter) Flush() {
+	w.commit()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the original http.ResponseWriter
+func (w *sessionWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// idFromMetadata read session token from grpc metadata key, Authorization header or cookies
+// forwarded by grpc-gateway
+func (m *Manager) idFromMetadata(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	if v := md.Get(m.opts.metadataKey); len(v) > 0 && v[0] != "" {
+		return v[0]
+	}
+
+	if v := md.Get("authorization"); len(v) > 0 {
+		if id := m.idFromAuthorization(v[0]); id != "" {
+			return id
+		}
+	}
+
+	cookies := append(md.Get("cookie"), md.Get("grpcgateway-cookie")...)
+	if len(cookies) > 0 {
+		r := http.Request{Header: http.Header{"Cookie": cookies}}
+		if c, err := r.Cookie(m.opts.cookieName); err == nil {
+			return c.Value
+		}
+	}
+	return ""
+}
+
+// commitGRPC persist session after handler and returns header metadata to send if session token changed
+func (m *Manager) commitGRPC(ctx context.Context, s *Session, loadedToken string) metadata.MD {
+	if !m.needsSave(s) {
+		return nil
+	}
+	if err := m.Save(ctx, s); err != nil {
+		log.Error("session: save failed", log.String("id", s.ID), log.Err(err))
+		return nil
+	}
+	if s.Token() == loadedToken {
+		return nil
+	}
+	return metadata.Pairs(m.opts.metadataKey, s.Token())
+}
+
+// UnaryServerInterceptor returns a grpc interceptor that load session into context and persist it
+// after handler returns, new session ids are sent back in header metadata.
+// It can be registered using grpcgw.RegisterInterceptors
+func (m *Manager) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		id := m.idFromMetadata(ctx)
+		s, err := m.loadOrNew(ctx, id, m.metadataFromContext(ctx))
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := handler(NewContext(ctx, s), req)
+		if md := m.commitGRPC(ctx, s, id); md != nil {
+			if err := grpc.SetHeader(ctx, md); err != nil {
+				log.Error("session: set header failed", log.Err(err))
+			}
+		}
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor returns a grpc stream interceptor that load session into context and persist it
+// before first message or header is sent so new session ids are sent back in header metadata, session
+// is saved again after handler returns if it's changed.
+// It can be registered using grpcgw.RegisterInterceptors
+func (m *Manager) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := ss.Context()
+		id := m.idFromMetadata(ctx)
+		s, err := m.loadOrNew(ctx, id, m.metadataFromContext(ctx))
+		if err != nil {
+			return err
+		}
+
+		wrapped := &sessionServerStream{
+			ServerStream: ss,
+			ctx:          NewContext(ctx, s),
+			manager:      m,
+			session:      s,
+			token:        id,
+		}
+		err = handler(srv, wrapped)
+		wrapped.commit()
+		return err
+	}
+}
+
+// sessionServerStream persist session and set its header right before headers are sent
+type sessionServerStream struct {
+	grpc.ServerStream
+	ctx        context.Context
+	manager    *Manager
+	session    *Session
+	token      string
+	headerSent bool
+}
+
+// Context returns context which carry session
+func (w *sessionServerStream) Context() context.Context {
+	return w.ctx
+}
+
+func (w *sessionServerStream) commit() {
+	md := w.manager.commitGRPC(w.ServerStream.Context(), w.session, w.token)
+	if md == nil {
+		return
+	}
+	if w.headerSent {
+		log.Error("session: token changed after headers are sent", log.String("id", w.session.ID))
+		return
+	}
+	if err := w.ServerStream.SetHeader(md); err != nil {
+		log.Error("session: set header failed", log.Err(err))
+		return
+	}
+	w.token = w.session.Token()
+}
+
+func (w *sessionServerStream) beforeHeader() {
+	if w.headerSent {
+		return
+	}
+	w.commit()
+	w.headerSent = true
+}
+
+// SendHeader implements grpc.ServerStream
+func (w *sessionServerStream) SendHeader(md metadata.MD) error {
+	w.beforeHeader()
+	return w.ServerStream.SendHeader(md)
+}
+
+// SendMsg implements grpc.ServerStream
+func (w *sessionServerStream) SendMsg(msg interface{}) error {
+	w.beforeHeader()
+	return w.ServerStream.SendMsg(msg)
+}
@@ -0,0 +1,166 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestMiddleware(t *testing.T) {
+	m := NewManager()
+
+	var seen *Session
+	h := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = FromContext(r.Context())
+		if r.URL.Path == "/login" {
+			_ = seen.Set("user", "john")
+		}
+		if r.URL.Path == "/logout" {
+			_ = m.Destroy(r.Context(), seen)
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+
+	// untouched new sessions are not stored
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.NotNil(t, seen)
+	assert.True(t, seen.IsNew())
+	assert.Empty(t, w.Result().Cookies())
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/login", nil))
+	assert.Equal(t, "ok", w.Body.String())
+	cookies := w.Result().Cookies()
+	assert.Len(t, cookies, 1)
+	id := cookies[0].Value
+
+	// cookie
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(cookies[0])
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	assert.Equal(t, id, seen.ID)
+	var user string
+	assert.Nil(t, seen.Get("user", &user))
+	assert.Equal(t, "john", user)
+
+	// authorization header
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Session "+id)
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	assert.Equal(t, id, seen.ID)
+
+	// logout
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodGet, "/logout", nil)
+	r.AddCookie(cookies[0])
+	h.ServeHTTP(w, r)
+	assert.Equal(t, -1, w.Result().Cookies()[0].MaxAge)
+	_, err := m.Load(context.Background(), id)
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	m := NewManager()
+	interceptor := m.UnaryServerInterceptor()
+
+	var seen *Session
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		seen = FromContext(ctx)
+		return nil, seen.Set("user", "john")
+	}
+
+	ctx := context.Background()
+	_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{}, handler)
+	assert.Nil(t, err)
+	assert.NotNil(t, seen)
+	id := seen.ID
+
+	for _, md := range []metadata.MD{
+		metadata.Pairs("session-id", id),
+		metadata.Pairs("authorization", "Session "+id),
+		metadata.Pairs("grpcgateway-cookie", "other=1; session_id="+id),
+	} {
+		_, err = interceptor(metadata.NewIncomingContext(ctx, md), nil, &grpc.UnaryServerInfo{}, handler)
+		assert.Nil(t, err)
+		assert.Equal(t, id, seen.ID)
+		assert.False(t, seen.IsNew())
+	}
+}
+
+type testServerStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	md   metadata.MD
+	sent bool
+	// mdOnSend is header metadata when first message is sent
+	mdOnSend metadata.MD
+}
+
+func (s *testServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *testServerStream) SetHeader(md metadata.MD) error {
+	if s.sent {
+		return errors.New("headers are already sent")
+	}
+	s.md = metadata.Join(s.md, md)
+	return nil
+}
+
+func (s *testServerStream) SendMsg(m interface{}) error {
+	if !s.sent {
+		s.sent = true
+		s.mdOnSend = s.md.Copy()
+	}
+	return nil
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	m := NewManager()
+	interceptor := m.StreamServerInterceptor()
+
+	var seen *Session
+	handler := func(srv interface{}, ss grpc.ServerStream) error {
+		seen = FromContext(ss.Context())
+		return seen.Set("user", "john")
+	}
+
+	ss := &testServerStream{ctx: context.Background()}
+	assert.Nil(t, interceptor(nil, ss, &grpc.StreamServerInfo{}, handler))
+	assert.NotNil(t, seen)
+	assert.Equal(t, []string{seen.ID}, ss.md.Get("session-id"))
+
+	id := seen.ID
+	ss = &testServerStream{ctx: metadata.NewIncomingContext(context.Background(), metadata.Pairs("session-id", id))}
+	assert.Nil(t, interceptor(nil, ss, &grpc.StreamServerInfo{}, handler))
+	assert.Equal(t, id, seen.ID)
+	assert.Empty(t, ss.md.Get("session-id"))
+
+	// session id is set before headers are sent with first message
+	ss = &testServerStream{ctx: context.Background()}
+	assert.Nil(t, interceptor(nil, ss, &grpc.StreamServerInfo{}, func(srv interface{}, stream grpc.ServerStream) error {
+		seen = FromContext(stream.Context())
+		if err := seen.Set("user", "john"); err != nil {
+			return err
+		}
+		if err := stream.SendMsg("first"); err != nil {
+			return err
+		}
+		// changes after first message are still saved
+		return seen.Set("step", "done")
+	}))
+	assert.Equal(t, []string{seen.ID}, ss.mdOnSend.Get("session-id"))
+	loaded, err := m.Load(context.Background(), seen.ID)
+	assert.Nil(t, err)
+	var step string
+	assert.Nil(t, loaded.Get("step", &step))
+	assert.Equal(t, "done", step)
+}
@@ -0,0 +1,324 @@
+package session
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/golang-tire/pkg/kv"
+)
+
+// redis hash fields of a session, each value has its own version field so requests
+// changing different fields of a session do not overwrite each other
+const (
+	metaField    = "_meta"
+	versionField = "_version"
+	valuePrefix  = "v:"
+	revPrefix    = "r:"
+	macField     = "_mac"
+)
+
+// signedSaveRetries is number of times a signed save is retried when hash is changed by
+// another save of a different field
+const signedSaveRetries = 10
+
+// NewRedisStore returns a Store that keep each session in a redis hash using given kv client,
+// changed fields are saved using compare and swap so concurrent changes of the same field
+// are rejected with ErrConflict. With Encrypt the whole hash is signed, so removed, replayed
+// or modified fields are rejected with ErrTampered
+func NewRedisStore(c *kv.Client, prefix string, opts ...StoreOption) Store {
+	o := newStoreOptions(opts)
+	return &redisStore{client: c, prefix: prefix, codec: codec{keyring: o.keyring}}
+}
+
+type redisStore struct {
+	client *kv.Client
+	prefix string
+	codec  codec
+}
+
+func (r *redisStore) key(id string) string {
+	return r.client.Key(r.prefix + id)
+}
+
+// signedFields returns signed form of hash fields of session id, values are replaced by their
+// sha256 digest so signature covers which fields exist, their versions and their values
+func signedFields(id string, fields map[string]string) []byte {
+	digests := make(map[string]string, len(fields))
+	for f, v := range fields {
+		switch {
+		case f == macField:
+		case strings.HasPrefix(f, valuePrefix):
+			sum := sha256.Sum256([]byte(v))
+			digests[f] = hex.EncodeToString(sum[:])
+		default:
+			digests[f] = v
+		}
+	}
+	// json sorts map keys so signed form does not depend on order of fields
+	data, _ := json.Marshal(struct {
+		ID     string            `json:"id"`
+		Fields map[string]string `json:"fields"`
+	}{ID: id, Fields: digests})
+	return data
+}
+
+// Load implements Store
+func (r *redisStore) Load(ctx context.Context, token string) (*Session, error) {
+	fields, err := r.client.Redis().HGetAll(ctx, r.key(token)).Result()
+	if err != nil {
+		return nil, err
+	}
+	meta, ok := fields[metaField]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if r.codec.keyring != nil && !r.codec.keyring.verify(signedFields(token, fields), fields[macField]) {
+		return nil, ErrTampered
+	}
+
+	s := &Session{
+		Values:   make(map[string]json.RawMessage),
+		versions: make(map[string]int64),
+	}
+	if err := r.codec.decodeMeta(token, []byte(meta), s); err != nil {
+		return nil, err
+	}
+	for f, v := range fields {
+		switch {
+		case f == versionField:
+			s.Version, _ = strconv.ParseInt(v, 10, 64)
+		case strings.HasPrefix(f, revPrefix):
+			s.versions[f[len(revPrefix):]], _ = strconv.ParseInt(v, 10, 64)
+		case strings.HasPrefix(f, valuePrefix):
+			key := f[len(valuePrefix):]
+			if s.Values[key], err = r.codec.decodeValue(token, key, []byte(v)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return s, nil
+}
+
+// saveScript check versions of changed fields and write them, ARGV is ttl, meta, must exist flag
+// and a (field, expected version, value) triple for each changed field, empty value deletes field.
+// It returns new session version followed by (field, version) pairs
+var saveScript = redis.NewScript(`
+local key = KEYS[1]
+if ARGV[3] == '1' and redis.call('EXISTS', key) == 0 then
+	return redis.error_reply('NOTFOUND')
+end
+for i = 4, #ARGV, 3 do
+	local rev = tonumber(redis.call('HGET', key, 'r:' .. ARGV[i]) or '0')
+	if rev ~= tonumber(ARGV[i + 1]) then
+		return redis.error_reply('CONFLICT ' .. ARGV[i])
+	end
+end
+local result = {0}
+for i = 4, #ARGV, 3 do
+	if ARGV[i + 2] == '' then
+		redis.call('HDEL', key, 'v:' .. ARGV[i])
+	else
+		redis.call('HSET', key, 'v:' .. ARGV[i], ARGV[i + 2])
+	end
+	table.insert(result, ARGV[i])
+	table.insert(result, redis.call('HINCRBY', key, 'r:' .. ARGV[i], 1))
+end
+redis.call('HSET', key, '_meta', ARGV[2])
+result[1] = redis.call('HINCRBY', key, '_version', 1)
+redis.call('PEXPIRE', key, ARGV[1])
+return result
+`)
+
+// Save implements Store
+func (r *redisStore) Save(ctx context.Context, s *Session, ttl time.Duration) (string, error) {
+	meta, err := r.codec.encodeMeta(s)
+	if err != nil {
+		return "", err
+	}
+
+	// changed fields mapped to their encoded value, empty value deletes field
+	values := make(map[string]string, len(s.changed))
+	for k := range s.changed {
+		var value []byte
+		if v, ok := s.Values[k]; ok {
+			if value, err = r.codec.encodeValue(s.ID, k, v); err != nil {
+				return "", err
+			}
+		}
+		values[k] = string(value)
+	}
+	if r.codec.keyring != nil {
+		if err := r.saveSigned(ctx, s, ttl, string(meta), values); err != nil {
+			return "", err
+		}
+		return s.ID, nil
+	}
+
+	mustExist := "0"
+	if s.stored() {
+		mustExist = "1"
+	}
+	args := []interface{}{ttl.Milliseconds(), string(meta), mustExist}
+	for k, value := range values {
+		args = append(args, k, s.versions[k], value)
+	}
+
+	v, err := saveScript.Run(ctx, r.client.Redis(), []string{r.key(s.ID)}, args...).Result()
+	if err != nil {
+		switch {
+		case strings.HasPrefix(err.Error(), "NOTFOUND"):
+			return "", ErrNotFound
+		case strings.HasPrefix(err.Error(), "CONFLICT"):
+			return "", ErrConflict
+		}
+		return "", err
+	}
+
+	res, _ := v.([]interface{})
+	if len(res) == 0 {
+		return "", redis.Nil
+	}
+	if s.versions == nil {
+		s.versions = make(map[string]int64)
+	}
+	s.Version, _ = res[0].(int64)
+	for i := 1; i+1 < len(res); i += 2 {
+		field, _ := res[i].(string)
+		s.versions[field], _ = res[i+1].(int64)
+	}
+	return s.ID, nil
+}
+
+// saveSigned save changed values like saveScript and sign the resulting hash, signature covers
+// all fields so it's computed here in a transaction which is retried if hash changes meanwhile
+func (r *redisStore) saveSigned(ctx context.Context, s *Session, ttl time.Duration, meta string, values map[string]string) error {
+	key := r.key(s.ID)
+	var (
+		version  int64
+		versions map[string]int64
+	)
+	txf := func(tx *redis.Tx) error {
+		fields, err := tx.HGetAll(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		if _, ok := fields[metaField]; !ok {
+			if s.stored() {
+				return ErrNotFound
+			}
+		} else if !r.codec.keyring.verify(signedFields(s.ID, fields), fields[macField]) {
+			return ErrTampered
+		}
+
+		versions = make(map[string]int64, len(values))
+		var (
+			set []interface{}
+			del []string
+		)
+		for k, value := range values {
+			rev, _ := strconv.ParseInt(fields[revPrefix+k], 10, 64)
+			if rev != s.versions[k] {
+				return ErrConflict
+			}
+			versions[k] = rev + 1
+			fields[revPrefix+k] = strconv.FormatInt(rev+1, 10)
+			set = append(set, revPrefix+k, rev+1)
+			if value == "" {
+				delete(fields, valuePrefix+k)
+				del = append(del, valuePrefix+k)
+			} else {
+				fields[valuePrefix+k] = value
+				set = append(set, valuePrefix+k, value)
+			}
+		}
+		version, _ = strconv.ParseInt(fields[versionField], 10, 64)
+		version++
+		fields[metaField] = meta
+		fields[versionField] = strconv.FormatInt(version, 10)
+		mac := r.codec.keyring.sign(signedFields(s.ID, fields))
+		set = append(set, metaField, meta, versionField, version, macField, mac)
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			if len(del) > 0 {
+				pipe.HDel(ctx, key, del...)
+			}
+			pipe.HSet(ctx, key, set...)
+			pipe.PExpire(ctx, key, ttl)
+			return nil
+		})
+		return err
+	}
+
+	for i := 0; i < signedSaveRetries; i++ {
+		err := r.client.Redis().Watch(ctx, txf, key)
+		if err == redis.TxFailedErr {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if s.versions == nil {
+			s.versions = make(map[string]int64)
+		}
+		s.Version = version
+		for k, v := range versions {
+			s.versions[k] = v
+		}
+		return nil
+	}
+	return ErrConflict
+}
+
+// Delete implements Store
+func (r *redisStore) Delete(ctx context.Context, token string) error {
+	return r.client.Redis().Del(ctx, r.key(token)).Err()
+}
+
+// userIndex returns sorted set of user session ids scored by their absolute expiry
+func (r *redisStore) userIndex(userID string) *kv.SortedSet {
+	return r.client.SortedSet(r.prefix + "user:" + userID)
+}
+
+// Index implements Indexer
+func (r *redisStore) Index(ctx context.Context, userID, id string, expiresAt time.Time) error {
+	idx := r.userIndex(userID)
+	if err := idx.Add(ctx, kv.ScoredMember{Member: id, Score: float64(expiresAt.Unix())}); err != nil {
+		return err
+	}
+	// drop sessions which passed their absolute expiry, idle ones are removed on ListSessions
+	if _, err := idx.PopByScore(ctx, float64(time.Now().Unix()), 100); err != nil {
+		return err
+	}
+	// index lives as long as the last expiring session of user
+	last, err := idx.Range(ctx, 0, 0, true)
+	if err != nil || len(last) == 0 {
+		return err
+	}
+	return idx.Expire(ctx, time.Until(time.Unix(int64(last[0].Score), 0)))
+}
+
+// Unindex implements Indexer
+func (r *redisStore) Unindex(ctx context.Context, userID string, ids ...string) error {
+	_, err := r.userIndex(userID).Remove(ctx, ids...)
+	return err
+}
+
+// UserSessions implements Indexer
+func (r *redisStore) UserSessions(ctx context.Context, userID string) ([]string, error) {
+	members, err := r.userIndex(userID).Range(ctx, 0, -1, false)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(members))
+	for i := range members {
+		ids[i] = members[i].Member
+	}
+	return ids, nil
+}
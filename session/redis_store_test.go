@@ -0,0 +1,100 @@
+package session
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang-tire/pkg/kv"
+	"github.com/stretchr/testify/assert"
+)
+
+func testConcurrentSave(t *testing.T, m *Manager) {
+	ctx := context.Background()
+
+	s, err := m.New(ctx)
+	assert.Nil(t, err)
+	assert.Nil(t, s.Set("a", 1))
+	assert.Nil(t, m.Save(ctx, s))
+	assert.Equal(t, int64(1), s.Version)
+
+	first, err := m.Load(ctx, s.ID)
+	assert.Nil(t, err)
+	second, err := m.Load(ctx, s.ID)
+	assert.Nil(t, err)
+
+	// different fields are merged
+	assert.Nil(t, first.Set("b", 2))
+	assert.Nil(t, second.Set("c", 3))
+	assert.Nil(t, m.Save(ctx, first))
+	assert.Nil(t, m.Save(ctx, second))
+	assert.Equal(t, int64(3), second.Version)
+
+	loaded, err := m.Load(ctx, s.ID)
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"a", "b", "c"}, loaded.Keys())
+
+	// same field conflicts
+	first, _ = m.Load(ctx, s.ID)
+	second, _ = m.Load(ctx, s.ID)
+	assert.Nil(t, first.Set("a", 10))
+	second.Delete("a")
+	assert.Nil(t, m.Save(ctx, first))
+	assert.Equal(t, ErrConflict, m.Save(ctx, second))
+
+	// a saved session can save again
+	assert.Nil(t, first.Set("a", 11))
+	assert.Nil(t, m.Save(ctx, first))
+
+	// update retries with fresh session
+	calls := 0
+	assert.Nil(t, m.Update(ctx, s.ID, func(u *Session) error {
+		calls++
+		if calls == 1 {
+			other, _ := m.Load(ctx, s.ID)
+			_ = other.Set("a", 20)
+			assert.Nil(t, m.Save(ctx, other))
+		}
+		var a int
+		assert.Nil(t, u.Get("a", &a))
+		return u.Set("a", a+1)
+	}))
+	assert.Equal(t, 2, calls)
+	loaded, _ = m.Load(ctx, s.ID)
+	var a int
+	assert.Nil(t, loaded.Get("a", &a))
+	assert.Equal(t, 21, a)
+
+	// revoked sessions are not recreated by in flight requests
+	assert.Nil(t, first.Set("b", 5))
+	assert.Nil(t, m.Destroy(ctx, loaded))
+	assert.Equal(t, ErrNotFound, m.Save(ctx, first))
+}
+
+func TestRedisStoreConcurrentSave(t *testing.T) {
+	testConcurrentSave(t, NewManager(KeyPrefix("cas:")))
+}
+
+func TestEncryptedRedisStoreConcurrentSave(t *testing.T) {
+	kr, err := NewKeyring(Key{ID: "k1", Secret: []byte("0123456789abcdef")})
+	assert.Nil(t, err)
+	testConcurrentSave(t, NewManager(KeyPrefix("cas-encrypted:"), WithKeyring(kr)))
+}
+
+func TestMemoryStoreConcurrentSave(t *testing.T) {
+	testConcurrentSave(t, NewManager(WithStore(NewMemoryStore(context.Background(), time.Minute))))
+}
+
+func TestRedisStoreRequestContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	m := NewManager()
+	s, err := m.New(ctx)
+	assert.Nil(t, err)
+	assert.Nil(t, m.Save(ctx, s))
+	_, err = m.Load(ctx, s.ID)
+	assert.Nil(t, err)
+	cancel()
+
+	// request context must not leak into shared client
+	assert.Nil(t, kv.Get().Set("after-request", "v", time.Minute))
+}
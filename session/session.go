@@ -2,13 +2,20 @@ package session
 
 import (
 	"encoding/json"
-	"github.com/golang-tire/pkg/kv"
+	"errors"
+	"sync"
 	"time"
+
+	"github.com/golang-tire/pkg/kv"
 )
 
 // Get get a data from session if its available
 func Get(key string, data interface{}) error {
-	val, err := kv.Get().GetString(key)
+	c := kv.Get()
+	if c == nil {
+		return ErrNoStore
+	}
+	val, err := c.GetString(key)
 	if err != nil {
 		return err
 	}
@@ -17,14 +24,184 @@ func Get(key string, data interface{}) error {
 
 // Set set new key/value into session data
 func Set(key string, data interface{}, duration time.Duration) error {
+	c := kv.Get()
+	if c == nil {
+		return ErrNoStore
+	}
 	val, err := json.Marshal(data)
 	if err != nil {
 		return err
 	}
-	return kv.Get().Set(key, string(val), duration)
+	return c.Set(key, string(val), duration)
 }
 
 // Delete will remove a key from session
 func Delete(key string) error {
-	return kv.Get().Delete(key)
+	c := kv.Get()
+	if c == nil {
+		return ErrNoStore
+	}
+	return c.Delete(key)
+}
+
+// ErrKeyNotFound is returned when a key does not exist in session values
+var ErrKeyNotFound = errors.New("session: key not found")
+
+// Session is a set of values stored for a client between requests
+type Session struct {
+	ID        string                     `json:"id"`
+	Values    map[string]json.RawMessage `json:"values"`
+	CreatedAt time.Time                  `json:"created_at"`
+	LastSeen  time.Time                  `json:"last_seen"`
+	// ExpiresAt is the absolute expiry time, sessions never live longer than it
+	// even if they are active
+	ExpiresAt time.Time `json:"expires_at"`
+	// UserID is the owner of session, sessions with a user are indexed by stores which
+	// implement Indexer so they can be listed and revoked together
+	UserID   string   `json:"user_id,omitempty"`
+	Metadata Metadata `json:"metadata"`
+	// Version is increased on each save
+	Version int64 `json:"version"`
+
+	lock      sync.RWMutex
+	dirty     bool
+	isNew     bool
+	destroyed bool
+	// token is what client keeps to find session, for server side stores it's the id
+	token    string
+	oldToken string
+	oldID    string
+	// changed keeps keys set or deleted since session is loaded and versions keeps version
+	// of fields when they are loaded, stores which support it use them to detect conflicts
+	changed  map[string]bool
+	versions map[string]int64
+}
+
+// ErrConflict is returned on save when a field changed by session is changed by another
+// request since session is loaded
+var ErrConflict = errors.New("session: conflicting update")
+
+// Metadata describe the client which created session
+type Metadata struct {
+	IP        string `json:"ip,omitempty"`
+	UserAgent string `json:"user_agent,omitempty"`
+	Device    string `json:"device,omitempty"`
+}
+
+// SetUser set owner of session, it should be called after Manager.Regenerate on login
+func (s *Session) SetUser(userID string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.UserID != userID {
+		s.UserID = userID
+		s.dirty = true
+	}
+}
+
+// Get decode value of key into out, it returns ErrKeyNotFound if key does not exist
+func (s *Session) Get(key string, out interface{}) error {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	v, ok := s.Values[key]
+	if !ok {
+		return ErrKeyNotFound
+	}
+	return json.Unmarshal(v, out)
+}
+
+// Set encode and set value of key
+func (s *Session) Set(key string, value interface{}) error {
+	v, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.Values == nil {
+		s.Values = make(map[string]json.RawMessage)
+	}
+	s.Values[key] = v
+	s.markChanged(key)
+	return nil
+}
+
+// Delete remove a key from session values
+func (s *Session) Delete(key string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.Values[key]; ok {
+		delete(s.Values, key)
+		s.markChanged(key)
+	}
+}
+
+// Clear remove all session values
+func (s *Session) Clear() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for k := range s.Values {
+		s.markChanged(k)
+	}
+	s.Values = make(map[string]json.RawMessage)
+	s.dirty = true
+}
+
+// markChanged mark key as changed, caller must hold the lock
+func (s *Session) markChanged(key string) {
+	if s.changed == nil {
+		s.changed = make(map[string]bool)
+	}
+	s.changed[key] = true
+	s.dirty = true
+}
+
+// stored returns true if session should already exist in store, caller must hold the lock
+func (s *Session) stored() bool {
+	return !s.isNew && s.oldID == ""
+}
+
+// Keys returns keys of session values
+func (s *Session) Keys() []string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	keys := make([]string, 0, len(s.Values))
+	for k := range s.Values {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// IsNew returns true if session is not saved yet
+func (s *Session) IsNew() bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.isNew
+}
+
+// Dirty returns true if session is changed since it was loaded
+func (s *Session) Dirty() bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.dirty
+}
+
+// touch mark session to be saved even if its values are not changed
+func (s *Session) touch() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.dirty = true
+}
+
+// Token returns what client should send to find the session, for server side stores it's
+// the session id and it's empty before session is saved
+func (s *Session) Token() string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.token
 }
@@ -3,6 +3,7 @@ package session
 import (
 	"context"
 	"github.com/golang-tire/pkg/kv"
+	"github.com/golang-tire/pkg/log"
 	"os"
 	"testing"
 	"time"
@@ -12,6 +13,10 @@ import (
 
 func TestMain(m *testing.M) {
 	ctx := context.Background()
+	if err := log.Init(ctx, true); err != nil {
+		panic(err)
+	}
+
 	_, err := kv.InitMock(ctx, nil)
 	if err != nil {
 		panic(err)
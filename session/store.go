@@ -0,0 +1,591 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/golang-tire/pkg/kv"
+)
+
+// Store persist sessions. Save returns the token that client keeps in its cookie or header
+// and Load receives it back, server side stores use session id as token while client side
+// stores can put the whole session in it
+type Store interface {
+	// Load returns session of token or ErrNotFound if it does not exist
+	Load(ctx context.Context, token string) (*Session, error)
+	// Save persist session for ttl and returns its token
+	Save(ctx context.Context, s *Session, ttl time.Duration) (string, error)
+	// Delete remove session of token
+	Delete(ctx context.Context, token string) error
+}
+
+type storeOptions struct {
+	keyring *Keyring
+}
+
+// A StoreOption sets options such as encryption of server side stores
+type StoreOption interface {
+	apply(*storeOptions)
+}
+
+// funcStoreOption wraps a function that modifies storeOptions into an
+// implementation of the StoreOption interface.
+type funcStoreOption struct {
+	f func(*storeOptions)
+}
+
+func (fso *funcStoreOption) apply(so *storeOptions) {
+	fso.f(so)
+}
+
+func newFuncStoreOption(f func(*storeOptions)) *funcStoreOption {
+	return &funcStoreOption{
+		f: f,
+	}
+}
+
+// Encrypt returns a StoreOption that encrypt session values and metadata using AES-GCM and
+// protect the whole session with an HMAC, so a leaked snapshot of store does not expose
+// session data and modified sessions are rejected with ErrTampered
+func Encrypt(kr *Keyring) StoreOption {
+	return newFuncStoreOption(func(o *storeOptions) {
+		o.keyring = kr
+	})
+}
+
+func newStoreOptions(opts []StoreOption) storeOptions {
+	var o storeOptions
+	for _, opt := range opts {
+		opt.apply(&o)
+	}
+	return o
+}
+
+// codec encode sessions to stored format, sessions are plain json unless a keyring is set
+type codec struct {
+	keyring *Keyring
+}
+
+// sealedSession is the stored format of an encrypted session, values and metadata are
+// encrypted and the rest is kept in plain text to be covered by the signature
+type sealedSession struct {
+	ID        string            `json:"id"`
+	Values    map[string]string `json:"values"`
+	Metadata  string            `json:"metadata"`
+	CreatedAt time.Time         `json:"created_at"`
+	LastSeen  time.Time         `json:"last_seen"`
+	ExpiresAt time.Time         `json:"expires_at"`
+	UserID    string            `json:"user_id,omitempty"`
+	Version   int64             `json:"version"`
+}
+
+type signedSession struct {
+	Session json.RawMessage `json:"session"`
+	MAC     string          `json:"mac"`
+}
+
+// valueAAD binds an encrypted value to its session and key so it can not be moved around
+func valueAAD(id, key string) []byte {
+	return []byte("value\x00" + id + "\x00" + key)
+}
+
+func metadataAAD(id string) []byte {
+	return []byte("metadata\x00" + id)
+}
+
+func sessionAAD(id string) []byte {
+	return []byte("session\x00" + id)
+}
+
+// sessionMeta is session without its values, stores which keep each field separately
+// use it to store the rest of session
+type sessionMeta struct {
+	CreatedAt time.Time `json:"created_at"`
+	LastSeen  time.Time `json:"last_seen"`
+	ExpiresAt time.Time `json:"expires_at"`
+	UserID    string    `json:"user_id,omitempty"`
+	Metadata  Metadata  `json:"metadata"`
+}
+
+// encodeMeta encode session without values, encrypted meta is bound to session id
+func (c codec) encodeMeta(s *Session) ([]byte, error) {
+	data, err := json.Marshal(sessionMeta{
+		CreatedAt: s.CreatedAt,
+		LastSeen:  s.LastSeen,
+		ExpiresAt: s.ExpiresAt,
+		UserID:    s.UserID,
+		Metadata:  s.Metadata,
+	})
+	if err != nil || c.keyring == nil {
+		return data, err
+	}
+	sealed, err := c.keyring.seal(data, sessionAAD(s.ID))
+	return []byte(sealed), err
+}
+
+// decodeMeta decode meta of session id into s
+func (c codec) decodeMeta(id string, data []byte, s *Session) error {
+	if c.keyring != nil {
+		var err error
+		if data, err = c.keyring.open(string(data), sessionAAD(id)); err != nil {
+			return err
+		}
+	}
+
+	var meta sessionMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return err
+	}
+	s.ID = id
+	s.CreatedAt = meta.CreatedAt
+	s.LastSeen = meta.LastSeen
+	s.ExpiresAt = meta.ExpiresAt
+	s.UserID = meta.UserID
+	s.Metadata = meta.Metadata
+	return nil
+}
+
+func (c codec) encodeValue(id, key string, v json.RawMessage) ([]byte, error) {
+	if c.keyring == nil {
+		return v, nil
+	}
+	sealed, err := c.keyring.seal(v, valueAAD(id, key))
+	return []byte(sealed), err
+}
+
+func (c codec) decodeValue(id, key string, data []byte) (json.RawMessage, error) {
+	if c.keyring == nil {
+		return data, nil
+	}
+	return c.keyring.open(string(data), valueAAD(id, key))
+}
+
+func (c codec) encode(s *Session) ([]byte, error) {
+	if c.keyring == nil {
+		return json.Marshal(s)
+	}
+
+	meta, err := json.Marshal(s.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	sealed := sealedSession{
+		ID:        s.ID,
+		Values:    make(map[string]string, len(s.Values)),
+		CreatedAt: s.CreatedAt,
+		LastSeen:  s.LastSeen,
+		ExpiresAt: s.ExpiresAt,
+		UserID:    s.UserID,
+		Version:   s.Version,
+	}
+	if sealed.Metadata, err = c.keyring.seal(meta, metadataAAD(s.ID)); err != nil {
+		return nil, err
+	}
+	for k, v := range s.Values {
+		if sealed.Values[k], err = c.keyring.seal(v, valueAAD(s.ID, k)); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := json.Marshal(sealed)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(signedSession{Session: data, MAC: c.keyring.sign(data)})
+}
+
+func (c codec) decode(data []byte) (*Session, error) {
+	s := &Session{}
+	if c.keyring == nil {
+		if err := json.Unmarshal(data, s); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+
+	var signed signedSession
+	if err := json.Unmarshal(data, &signed); err != nil || !c.keyring.verify(signed.Session, signed.MAC) {
+		return nil, ErrTampered
+	}
+	var sealed sealedSession
+	if err := json.Unmarshal(signed.Session, &sealed); err != nil {
+		return nil, ErrTampered
+	}
+
+	meta, err := c.keyring.open(sealed.Metadata, metadataAAD(sealed.ID))
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(meta, &s.Metadata); err != nil {
+		return nil, err
+	}
+
+	s.ID = sealed.ID
+	s.CreatedAt = sealed.CreatedAt
+	s.LastSeen = sealed.LastSeen
+	s.ExpiresAt = sealed.ExpiresAt
+	s.UserID = sealed.UserID
+	s.Version = sealed.Version
+	s.Values = make(map[string]json.RawMessage, len(sealed.Values))
+	for k, v := range sealed.Values {
+		if s.Values[k], err = c.keyring.open(v, valueAAD(sealed.ID, k)); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// NewKVStore returns a Store that keep sessions in any kv.Store e.g. kv.DiskStore
+func NewKVStore(st kv.Store, prefix string, opts ...StoreOption) Store {
+	o := newStoreOptions(opts)
+	return &kvStore{store: st, prefix: prefix, codec: codec{keyring: o.keyring}}
+}
+
+type kvStore struct {
+	store  kv.Store
+	prefix string
+	codec  codec
+}
+
+func (k *kvStore) Load(ctx context.Context, token string) (*Session, error) {
+	val, err := k.store.Get(ctx, k.prefix+token)
+	if err == kv.ErrNotFound {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return k.codec.decode([]byte(val))
+}
+
+// Save implements Store, kv stores have no compare and swap so last write wins
+func (k *kvStore) Save(ctx context.Context, s *Session, ttl time.Duration) (string, error) {
+	s.Version++
+	data, err := k.codec.encode(s)
+	if err == nil {
+		err = k.store.Set(ctx, k.prefix+s.ID, string(data), ttl)
+	}
+	if err != nil {
+		s.Version--
+		return "", err
+	}
+	return s.ID, nil
+}
+
+func (k *kvStore) Delete(ctx context.Context, token string) error {
+	return k.store.Delete(ctx, k.prefix+token)
+}
+
+// userIndex returns key of user index, it's a json map of session ids to their absolute expiry
+func (k *kvStore) userIndex(userID string) string {
+	return k.prefix + "user:" + userID
+}
+
+func (k *kvStore) loadIndex(ctx context.Context, userID string) (map[string]time.Time, error) {
+	ids := make(map[string]time.Time)
+	val, err := k.store.Get(ctx, k.userIndex(userID))
+	if err == kv.ErrNotFound {
+		return ids, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(val), &ids); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// saveIndex drop expired sessions from index and save it until the last session expires
+func (k *kvStore) saveIndex(ctx context.Context, userID string, ids map[string]time.Time) error {
+	now := time.Now()
+	var last time.Time
+	for id, expiresAt := range ids {
+		if now.After(expiresAt) {
+			delete(ids, id)
+			continue
+		}
+		if expiresAt.After(last) {
+			last = expiresAt
+		}
+	}
+	if len(ids) == 0 {
+		return k.store.Delete(ctx, k.userIndex(userID))
+	}
+
+	data, err := json.Marshal(ids)
+	if err != nil {
+		return err
+	}
+	return k.store.Set(ctx, k.userIndex(userID), string(data), last.Sub(now))
+}
+
+// Index implements Indexer, like sessions index is saved without compare and swap so
+// concurrent changes of one user index may be lost
+func (k *kvStore) Index(ctx context.Context, userID, id string, expiresAt time.Time) error {
+	ids, err := k.loadIndex(ctx, userID)
+	if err != nil {
+		return err
+	}
+	ids[id] = expiresAt
+	return k.saveIndex(ctx, userID, ids)
+}
+
+// Unindex implements Indexer
+func (k *kvStore) Unindex(ctx context.Context, userID string, ids ...string) error {
+	index, err := k.loadIndex(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		delete(index, id)
+	}
+	return k.saveIndex(ctx, userID, index)
+}
+
+// UserSessions implements Indexer
+func (k *kvStore) UserSessions(ctx context.Context, userID string) ([]string, error) {
+	index, err := k.loadIndex(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(index))
+	for id := range index {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// MemoryStore is a Store that keep sessions in process memory, like redis store fields are
+// versioned and concurrent changes of the same field are rejected with ErrConflict
+type MemoryStore struct {
+	lock     sync.RWMutex
+	sessions map[string]*memoryEntry
+	users    map[string]map[string]time.Time
+	codec    codec
+	expired  []func(s *Session)
+}
+
+type memoryEntry struct {
+	meta      []byte
+	values    map[string][]byte
+	versions  map[string]int64
+	version   int64
+	expiresAt time.Time
+}
+
+// NewMemoryStore returns an in memory Store, expired sessions are removed every sweep interval
+// until ctx is done
+func NewMemoryStore(ctx context.Context, sweepInterval time.Duration, opts ...StoreOption) *MemoryStore {
+	o := newStoreOptions(opts)
+	m := &MemoryStore{
+		sessions: make(map[string]*memoryEntry),
+		users:    make(map[string]map[string]time.Time),
+		codec:    codec{keyring: o.keyring},
+	}
+	if sweepInterval > 0 {
+		go func() {
+			ticker := time.NewTicker(sweepInterval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					m.sweep()
+				}
+			}
+		}()
+	}
+	return m
+}
+
+// onExpired register a callback of sessions removed by sweeper
+func (m *MemoryStore) onExpired(fn func(s *Session)) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.expired = append(m.expired, fn)
+}
+
+func (m *MemoryStore) sweep() {
+	m.lock.Lock()
+	now := time.Now()
+	var removed []*Session
+	for token, e := range m.sessions {
+		if now.After(e.expiresAt) {
+			delete(m.sessions, token)
+			if len(m.expired) > 0 {
+				s := &Session{ID: token}
+				_ = m.codec.decodeMeta(token, e.meta, s)
+				removed = append(removed, s)
+			}
+		}
+	}
+	callbacks := m.expired
+	m.lock.Unlock()
+
+	for _, s := range removed {
+		for _, fn := range callbacks {
+			fn(s)
+		}
+	}
+}
+
+// entry returns live entry of token, caller must hold the lock
+func (m *MemoryStore) entry(token string) *memoryEntry {
+	e, ok := m.sessions[token]
+	if !ok || time.Now().After(e.expiresAt) {
+		return nil
+	}
+	return e
+}
+
+// Load implements Store
+func (m *MemoryStore) Load(ctx context.Context, token string) (*Session, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	e := m.entry(token)
+	if e == nil {
+		return nil, ErrNotFound
+	}
+
+	s := &Session{
+		Values:   make(map[string]json.RawMessage, len(e.values)),
+		Version:  e.version,
+		versions: make(map[string]int64, len(e.versions)),
+	}
+	if err := m.codec.decodeMeta(token, e.meta, s); err != nil {
+		return nil, err
+	}
+	for k, v := range e.values {
+		val, err := m.codec.decodeValue(token, k, v)
+		if err != nil {
+			return nil, err
+		}
+		s.Values[k] = val
+	}
+	for k, v := range e.versions {
+		s.versions[k] = v
+	}
+	return s, nil
+}
+
+// Save implements Store
+func (m *MemoryStore) Save(ctx context.Context, s *Session, ttl time.Duration) (string, error) {
+	meta, err := m.codec.encodeMeta(s)
+	if err != nil {
+		return "", err
+	}
+	values := make(map[string][]byte, len(s.changed))
+	for k := range s.changed {
+		v, ok := s.Values[k]
+		if !ok {
+			continue
+		}
+		if values[k], err = m.codec.encodeValue(s.ID, k, v); err != nil {
+			return "", err
+		}
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	e := m.entry(s.ID)
+	if e == nil {
+		if s.stored() {
+			return "", ErrNotFound
+		}
+		e = &memoryEntry{values: make(map[string][]byte), versions: make(map[string]int64)}
+	}
+	for k := range s.changed {
+		if e.versions[k] != s.versions[k] {
+			return "", ErrConflict
+		}
+	}
+
+	if s.versions == nil {
+		s.versions = make(map[string]int64)
+	}
+	for k := range s.changed {
+		if v, ok := values[k]; ok {
+			e.values[k] = v
+		} else {
+			delete(e.values, k)
+		}
+		e.versions[k]++
+		s.versions[k] = e.versions[k]
+	}
+	e.meta = meta
+	e.version++
+	e.expiresAt = time.Now().Add(ttl)
+	m.sessions[s.ID] = e
+	s.Version = e.version
+	return s.ID, nil
+}
+
+// Delete implements Store
+func (m *MemoryStore) Delete(ctx context.Context, token string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	delete(m.sessions, token)
+	return nil
+}
+
+// Len returns number of stored sessions, it may include expired sessions not swept yet
+func (m *MemoryStore) Len() int {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return len(m.sessions)
+}
+
+// Index implements Indexer
+func (m *MemoryStore) Index(ctx context.Context, userID, id string, expiresAt time.Time) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	ids, ok := m.users[userID]
+	if !ok {
+		ids = make(map[string]time.Time)
+		m.users[userID] = ids
+	}
+	ids[id] = expiresAt
+
+	// drop sessions which passed their absolute expiry, idle ones are removed on ListSessions
+	now := time.Now()
+	for id, expiresAt := range ids {
+		if now.After(expiresAt) {
+			delete(ids, id)
+		}
+	}
+	return nil
+}
+
+// Unindex implements Indexer
+func (m *MemoryStore) Unindex(ctx context.Context, userID string, ids ...string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for _, id := range ids {
+		delete(m.users[userID], id)
+	}
+	if len(m.users[userID]) == 0 {
+		delete(m.users, userID)
+	}
+	return nil
+}
+
+// UserSessions implements Indexer
+func (m *MemoryStore) UserSessions(ctx context.Context, userID string) ([]string, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	ids := make([]string, 0, len(m.users[userID]))
+	for id := range m.users[userID] {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
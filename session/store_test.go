@@ -0,0 +1,106 @@
+package session
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testStore(t *testing.T, m *Manager) {
+	ctx := context.Background()
+
+	s, err := m.New(ctx)
+	assert.Nil(t, err)
+	assert.Nil(t, s.Set("user", "john"))
+	assert.Nil(t, m.Save(ctx, s))
+	assert.NotEmpty(t, s.Token())
+
+	loaded, err := m.Load(ctx, s.Token())
+	assert.Nil(t, err)
+	assert.Equal(t, s.ID, loaded.ID)
+	var user string
+	assert.Nil(t, loaded.Get("user", &user))
+	assert.Equal(t, "john", user)
+
+	assert.Nil(t, m.Regenerate(ctx, loaded))
+	assert.Nil(t, m.Save(ctx, loaded))
+	loaded, err = m.Load(ctx, loaded.Token())
+	assert.Nil(t, err)
+	assert.Nil(t, loaded.Get("user", &user))
+}
+
+func TestMemoryStore(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	st := NewMemoryStore(ctx, 10*time.Millisecond)
+	testStore(t, NewManager(WithStore(st)))
+
+	s := &Session{ID: "short", isNew: true}
+	_, err := st.Save(ctx, s, 20*time.Millisecond)
+	assert.Nil(t, err)
+	assert.Eventually(t, func() bool {
+		_, err := st.Load(ctx, "short")
+		return err == ErrNotFound
+	}, time.Second, 10*time.Millisecond)
+
+	m := NewManager(WithStore(st))
+	s, err = m.New(ctx)
+	assert.Nil(t, err)
+	assert.Nil(t, s.Set("a", 1))
+	assert.Nil(t, m.Save(ctx, s))
+	assert.Nil(t, m.Destroy(ctx, s))
+	_, err = st.Load(ctx, s.ID)
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestRedisStore(t *testing.T) {
+	testStore(t, NewManager())
+}
+
+func TestCookieStore(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := NewCookieStore(nil, nil)
+	assert.NotNil(t, err)
+	_, err = NewCookieStore([]byte("hash"), []byte("bad"))
+	assert.NotNil(t, err)
+
+	signed, err := NewCookieStore([]byte("hash-key"), nil)
+	assert.Nil(t, err)
+	testStore(t, NewManager(WithStore(signed)))
+
+	encrypted, err := NewCookieStore([]byte("hash-key"), []byte("0123456789abcdef0123456789abcdef"))
+	assert.Nil(t, err)
+	testStore(t, NewManager(WithStore(encrypted)))
+
+	s := &Session{ID: "id"}
+	assert.Nil(t, s.Set("secret", "value"))
+	token, err := encrypted.Save(ctx, s, time.Minute)
+	assert.Nil(t, err)
+
+	// tampered token
+	_, err = encrypted.Load(ctx, token[:len(token)-2]+"xx")
+	assert.Equal(t, ErrInvalidToken, err)
+	_, err = encrypted.Load(ctx, "garbage")
+	assert.Equal(t, ErrInvalidToken, err)
+
+	// other key
+	other, _ := NewCookieStore([]byte("other-key"), nil)
+	_, err = other.Load(ctx, token)
+	assert.Equal(t, ErrInvalidToken, err)
+
+	// expired
+	token, err = encrypted.Save(ctx, s, -time.Second)
+	assert.Nil(t, err)
+	_, err = encrypted.Load(ctx, token)
+	assert.Equal(t, ErrNotFound, err)
+
+	// too large for a cookie
+	assert.Nil(t, s.Set("big", strings.Repeat("x", maxCookieSize)))
+	_, err = signed.Save(ctx, s, time.Minute)
+	assert.Equal(t, ErrTokenTooLarge, err)
+}
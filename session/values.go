@@ -0,0 +1,49 @@
+package session
+
+import (
+	"time"
+)
+
+// flashPrefix is prefix of session keys which keep flash messages
+const flashPrefix = "_flash:"
+
+// GetString returns string value of key
+func (s *Session) GetString(key string) (string, error) {
+	var v string
+	err := s.Get(key, &v)
+	return v, err
+}
+
+// GetInt returns int value of key
+func (s *Session) GetInt(key string) (int, error) {
+	var v int
+	err := s.Get(key, &v)
+	return v, err
+}
+
+// GetTime returns time value of key, times are stored in RFC 3339 format
+func (s *Session) GetTime(key string) (time.Time, error) {
+	var v time.Time
+	err := s.Get(key, &v)
+	return v, err
+}
+
+// AddFlash add a message to be shown once in the next request e.g. after a redirect,
+// messages are grouped by category like "error" or "info"
+func (s *Session) AddFlash(category, message string) error {
+	var messages []string
+	if err := s.Get(flashPrefix+category, &messages); err != nil && err != ErrKeyNotFound {
+		return err
+	}
+	return s.Set(flashPrefix+category, append(messages, message))
+}
+
+// Flashes returns flash messages of category and remove them from session
+func (s *Session) Flashes(category string) []string {
+	var messages []string
+	if err := s.Get(flashPrefix+category, &messages); err == ErrKeyNotFound {
+		return nil
+	}
+	s.Delete(flashPrefix + category)
+	return messages
+}
@@ -0,0 +1,59 @@
+package session
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTypedValues(t *testing.T) {
+	s, err := NewManager().New(context.Background())
+	assert.Nil(t, err)
+
+	now := time.Now().Round(time.Second)
+	assert.Nil(t, s.Set("name", "john"))
+	assert.Nil(t, s.Set("age", 42))
+	assert.Nil(t, s.Set("login", now))
+
+	name, err := s.GetString("name")
+	assert.Nil(t, err)
+	assert.Equal(t, "john", name)
+
+	age, err := s.GetInt("age")
+	assert.Nil(t, err)
+	assert.Equal(t, 42, age)
+
+	login, err := s.GetTime("login")
+	assert.Nil(t, err)
+	assert.True(t, now.Equal(login))
+
+	_, err = s.GetInt("name")
+	assert.NotNil(t, err)
+	_, err = s.GetString("missing")
+	assert.Equal(t, ErrKeyNotFound, err)
+}
+
+func TestFlashes(t *testing.T) {
+	ctx := context.Background()
+	m := NewManager()
+
+	s, err := m.New(ctx)
+	assert.Nil(t, err)
+	assert.Nil(t, s.AddFlash("info", "saved"))
+	assert.Nil(t, s.AddFlash("info", "sent"))
+	assert.Nil(t, s.AddFlash("error", "failed"))
+	assert.Nil(t, m.Save(ctx, s))
+
+	loaded, err := m.Load(ctx, s.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"saved", "sent"}, loaded.Flashes("info"))
+	assert.Nil(t, loaded.Flashes("info"))
+	assert.Nil(t, m.Save(ctx, loaded))
+
+	loaded, err = m.Load(ctx, s.ID)
+	assert.Nil(t, err)
+	assert.Nil(t, loaded.Flashes("info"))
+	assert.Equal(t, []string{"failed"}, loaded.Flashes("error"))
+}